@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+// QUIC sends the end of a reply after the handler returned,
+// the reply paths are collected for this long afterwards
+const accessLogLinger = 20 * time.Millisecond
+
+// AccessLogEntry is the JSON line logged per request
+type AccessLogEntry struct {
+	Time     string `json:"time"`
+	Server   string `json:"server"`
+	Selector string `json:"selector"`
+	RemoteIA string `json:"remote_ia"`
+	Remote   string `json:"remote"`
+	Host     string `json:"host"`
+	Method   string `json:"method"`
+	URI      string `json:"uri"`
+	Proto    string `json:"proto"`
+	Status   int    `json:"status"`
+	Bytes    int64  `json:"bytes"`
+	// seconds until the handler returned
+	Duration float64 `json:"duration"`
+	// the paths the packets to the remote were sent over while the request was served,
+	// in the order they were first used
+	Paths []AccessLogPath `json:"paths"`
+}
+
+// AccessLogPath is a reply path of a request
+type AccessLogPath struct {
+	Fingerprint string `json:"fingerprint"`
+	// interfaces along the path as IA#interface ID, empty for remotes in the local AS
+	Hops    string `json:"hops"`
+	Packets int    `json:"packets"`
+}
+
+/*
+The handlers only see the remote address of a request, the reply paths are chosen per
+packet by the meteredConn below QUIC. It reports every written packet to the remotes
+with requests in progress. Packets of requests of the same remote served at the same
+time, e.g. on the streams of one HTTP/3 connection, count for all of them.
+The watches are kept per remote, such that packets to different remotes written by
+the servers at the same time do not wait for each other.
+*/
+type replyPathLog struct {
+	watching atomic.Int64
+	// remote address to *remoteWatches
+	watches sync.Map
+}
+
+// remoteWatches are the watches of the requests of a remote in progress
+type remoteWatches struct {
+	mtx     sync.Mutex
+	watches []*pathWatch
+	// set once the entry was deleted from the log, watches must not be added anymore
+	removed bool
+}
+
+type pathWatch struct {
+	paths   []*pan.Path
+	packets []int
+}
+
+var replyPaths = &replyPathLog{}
+
+// watch starts collecting the reply paths to remote
+func (l *replyPathLog) watch(remote string) *pathWatch {
+	w := &pathWatch{}
+	for {
+		v, _ := l.watches.LoadOrStore(remote, &remoteWatches{})
+		rw := v.(*remoteWatches)
+		rw.mtx.Lock()
+		if rw.removed {
+			rw.mtx.Unlock()
+			continue
+		}
+		rw.watches = append(rw.watches, w)
+		rw.mtx.Unlock()
+		l.watching.Add(1)
+		return w
+	}
+}
+
+// stop ends collecting the reply paths of w and returns them
+func (l *replyPathLog) stop(remote string, w *pathWatch) []AccessLogPath {
+	if v, ok := l.watches.Load(remote); ok {
+		rw := v.(*remoteWatches)
+		rw.mtx.Lock()
+		for i, cur := range rw.watches {
+			if cur == w {
+				rw.watches = append(rw.watches[:i], rw.watches[i+1:]...)
+				l.watching.Add(-1)
+				break
+			}
+		}
+		if len(rw.watches) == 0 {
+			rw.removed = true
+			l.watches.Delete(remote)
+		}
+		rw.mtx.Unlock()
+	}
+
+	// w is no longer reported to
+	paths := make([]AccessLogPath, len(w.paths))
+	for i, p := range w.paths {
+		paths[i] = AccessLogPath{Fingerprint: "local", Packets: w.packets[i]}
+		if p != nil {
+			paths[i].Fingerprint = string(p.Fingerprint)
+			paths[i].Hops = hopSequence(p)
+		}
+	}
+	return paths
+}
+
+// wrote reports a packet written to remote over path, nil for remotes in the local AS
+func (l *replyPathLog) wrote(remote pan.UDPAddr, path *pan.Path) {
+	if l.watching.Load() == 0 {
+		return
+	}
+	v, ok := l.watches.Load(remote.String())
+	if !ok {
+		return
+	}
+	rw := v.(*remoteWatches)
+	rw.mtx.Lock()
+	defer rw.mtx.Unlock()
+	for _, w := range rw.watches {
+		w.add(path)
+	}
+}
+
+func (w *pathWatch) add(path *pan.Path) {
+	for i, p := range w.paths {
+		if p == path || (p != nil && path != nil && p.Fingerprint == path.Fingerprint) {
+			w.packets[i]++
+			return
+		}
+	}
+	w.paths = append(w.paths, path)
+	w.packets = append(w.packets, 1)
+}
+
+// hopSequence lists the interfaces of the path like the interfaces of a topology file
+func hopSequence(p *pan.Path) string {
+	if p.Metadata == nil {
+		return ""
+	}
+	hops := make([]string, len(p.Metadata.Interfaces))
+	for i, iface := range p.Metadata.Interfaces {
+		hops[i] = fmt.Sprintf("%s#%d", iface.IA, iface.IfID)
+	}
+	return strings.Join(hops, " ")
+}
+
+// the entries of all servers are written as JSON lines to stdout
+var (
+	accessLogMtx sync.Mutex
+	accessLogEnc = json.NewEncoder(os.Stdout)
+)
+
+// accessLog logs every request of the server replying via rs, see AccessLogEntry
+func accessLog(h http.Handler, rs pan.ReplySelector) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		watch := replyPaths.watch(r.RemoteAddr)
+		lw := &loggingWriter{ResponseWriter: w}
+		h.ServeHTTP(lw, r)
+		lw.Flush()
+		duration := time.Since(start)
+
+		// the selector is looked up per request as it might be swapped via the admin API
+		cur := rs
+		if srs, ok := rs.(*SwappableReplySelector); ok {
+			cur = srs.Current()
+		}
+		entry := &AccessLogEntry{
+			Time:     start.Format(time.RFC3339Nano),
+			Server:   selectorName(rs),
+			Selector: fmt.Sprintf("%T", cur),
+			Remote:   r.RemoteAddr,
+			Host:     r.Host,
+			Method:   r.Method,
+			URI:      r.RequestURI,
+			Proto:    r.Proto,
+			Status:   lw.status,
+			Bytes:    lw.bytes,
+			Duration: duration.Seconds(),
+		}
+		if remote, err := pan.ParseUDPAddr(r.RemoteAddr); err == nil {
+			entry.RemoteIA = remote.IA.String()
+		}
+		if entry.Status == 0 {
+			entry.Status = http.StatusOK
+		}
+		time.AfterFunc(accessLogLinger, func() {
+			entry.Paths = replyPaths.stop(r.RemoteAddr, watch)
+			accessLogMtx.Lock()
+			defer accessLogMtx.Unlock()
+			_ = accessLogEnc.Encode(entry)
+		})
+	})
+}
+
+// loggingWriter records the status and the size of a reply
+type loggingWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (lw *loggingWriter) WriteHeader(status int) {
+	if lw.status == 0 {
+		lw.status = status
+	}
+	lw.ResponseWriter.WriteHeader(status)
+}
+
+func (lw *loggingWriter) Write(b []byte) (int, error) {
+	if lw.status == 0 {
+		lw.status = http.StatusOK
+	}
+	n, err := lw.ResponseWriter.Write(b)
+	lw.bytes += int64(n)
+	return n, err
+}
+
+// Flush hands the buffered reply to QUIC, such that it is sent before the paths are logged
+func (lw *loggingWriter) Flush() {
+	if f, ok := lw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (lw *loggingWriter) Unwrap() http.ResponseWriter {
+	return lw.ResponseWriter
+}
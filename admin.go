@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// ServerRegistry keeps track of the running servers and their reply selectors
+// so that the admin API can inspect and replace them
+type ServerRegistry struct {
+	mtx     sync.RWMutex
+	src     PathSource
+	servers map[string]*registeredServer
+	order   []string
+}
+
+type registeredServer struct {
+	name string
+	addr string
+	rs   *SwappableReplySelector
+	// configuration of the active selector, nil if it was not built from one
+	cfg *SelectorConfig
+}
+
+// ServerInfo describes a server in admin API responses
+type ServerInfo struct {
+	Name     string          `json:"name"`
+	Addr     string          `json:"addr"`
+	Selector string          `json:"selector"`
+	Config   *SelectorConfig `json:"config,omitempty"`
+}
+
+// new selectors built by the admin API query their paths from src
+func NewServerRegistry(src PathSource) *ServerRegistry {
+	return &ServerRegistry{
+		src:     src,
+		servers: make(map[string]*registeredServer),
+	}
+}
+
+// Register wraps the reply selector of a server such that it can be swapped at runtime,
+// the returned selector has to be used for listening
+func (reg *ServerRegistry) Register(name, addr string, rs pan.ReplySelector, cfg *SelectorConfig) *SwappableReplySelector {
+	reg.mtx.Lock()
+	defer reg.mtx.Unlock()
+	srv := &registeredServer{
+		name: name,
+		addr: addr,
+		rs:   NewSwappableReplySelector(rs),
+		cfg:  cfg,
+	}
+	srv.rs.SetName(name)
+	if _, ok := reg.servers[name]; !ok {
+		reg.order = append(reg.order, name)
+	}
+	reg.servers[name] = srv
+	return srv.rs
+}
+
+func (reg *ServerRegistry) info(srv *registeredServer) ServerInfo {
+	return ServerInfo{
+		Name:     srv.name,
+		Addr:     srv.addr,
+		Selector: fmt.Sprintf("%T", srv.rs.Current()),
+		Config:   srv.cfg,
+	}
+}
+
+// Servers lists all registered servers in registration order
+func (reg *ServerRegistry) Servers() []ServerInfo {
+	reg.mtx.RLock()
+	defer reg.mtx.RUnlock()
+	infos := make([]ServerInfo, 0, len(reg.order))
+	for _, name := range reg.order {
+		infos = append(infos, reg.info(reg.servers[name]))
+	}
+	return infos
+}
+
+// SwapSelector validates cfg and replaces the reply selector of the named server
+func (reg *ServerRegistry) SwapSelector(name string, cfg *SelectorConfig) (ServerInfo, error) {
+	if errs := cfg.validate("selector"); len(errs) > 0 {
+		return ServerInfo{}, fmt.Errorf("invalid selector:\n%w", errors.Join(errs...))
+	}
+	reg.mtx.Lock()
+	defer reg.mtx.Unlock()
+	srv, ok := reg.servers[name]
+	if !ok {
+		return ServerInfo{}, errUnknownServer
+	}
+	rs, err := cfg.build(reg.src)
+	if err != nil {
+		return ServerInfo{}, fmt.Errorf("invalid selector: %w", err)
+	}
+	srv.rs.Swap(rs)
+	srv.cfg = cfg
+	log.Printf("Admin: swapped reply selector of %s server to %s\n", name, cfg.Type)
+	return reg.info(srv), nil
+}
+
+// PathTables returns the path tables of the active selector of the named server
+func (reg *ServerRegistry) PathTables(name string) ([]SelectorPathTable, error) {
+	reg.mtx.RLock()
+	srv, ok := reg.servers[name]
+	reg.mtx.RUnlock()
+	if !ok {
+		return nil, errUnknownServer
+	}
+	return pathTables(srv.rs), nil
+}
+
+// AllPathTables returns the path tables of all servers by server name
+func (reg *ServerRegistry) AllPathTables() map[string][]SelectorPathTable {
+	reg.mtx.RLock()
+	defer reg.mtx.RUnlock()
+	tables := make(map[string][]SelectorPathTable, len(reg.servers))
+	for name, srv := range reg.servers {
+		tables[name] = pathTables(srv.rs)
+	}
+	return tables
+}
+
+// weightedSelector is implemented by selectors whose path weights can be changed live
+type weightedSelector interface {
+	SetWeights(weights []float64) error
+}
+
+// SetWeights replaces the path weights of the active selector of the named server,
+// which has to be a weighted selector
+func (reg *ServerRegistry) SetWeights(name string, weights []float64) (ServerInfo, error) {
+	if err := validateWeights(weights); err != nil {
+		return ServerInfo{}, err
+	}
+	reg.mtx.Lock()
+	defer reg.mtx.Unlock()
+	srv, ok := reg.servers[name]
+	if !ok {
+		return ServerInfo{}, errUnknownServer
+	}
+	ws, ok := srv.rs.Current().(weightedSelector)
+	if !ok {
+		return ServerInfo{}, fmt.Errorf("%s server has no weighted selector", name)
+	}
+	if err := ws.SetWeights(weights); err != nil {
+		return ServerInfo{}, err
+	}
+	if srv.cfg != nil {
+		cfg := *srv.cfg
+		cfg.Weights = weights
+		cfg.WeightBy = ""
+		srv.cfg = &cfg
+	}
+	log.Printf("Admin: set path weights of %s server to %v\n", name, weights)
+	return reg.info(srv), nil
+}
+
+var errUnknownServer = errors.New("unknown server")
+
+// Handler serves the admin API:
+//
+//	GET /servers                 lists all servers and their active selectors
+//	GET /servers/<name>          shows one server
+//	PUT /servers/<name>/selector replaces its selector by the SelectorConfig in the body
+//	PUT /servers/<name>/weights  sets the path weights of its weighted selector to the JSON array in the body
+//	GET /servers/<name>/paths    dumps the path tables of its selector, see pathtable.go
+//	GET /paths                   dumps the path tables of all servers by server name
+//	GET /metrics                 serves the Prometheus metrics, see metrics.go
+func (reg *ServerRegistry) Handler() http.Handler {
+	m := http.NewServeMux()
+	m.Handle("/metrics", promhttp.Handler())
+	m.HandleFunc("/servers", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "wrong method: "+r.Method, http.StatusMethodNotAllowed)
+			return
+		}
+		writeJSON(w, http.StatusOK, reg.Servers())
+	})
+	m.HandleFunc("/paths", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "wrong method: "+r.Method, http.StatusMethodNotAllowed)
+			return
+		}
+		writeJSON(w, http.StatusOK, reg.AllPathTables())
+	})
+	m.HandleFunc("/servers/", func(w http.ResponseWriter, r *http.Request) {
+		name, sub, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/servers/"), "/")
+		switch {
+		case sub == "" && r.Method == http.MethodGet:
+			for _, info := range reg.Servers() {
+				if info.Name == name {
+					writeJSON(w, http.StatusOK, info)
+					return
+				}
+			}
+			http.Error(w, errUnknownServer.Error()+": "+name, http.StatusNotFound)
+		case sub == "selector" && (r.Method == http.MethodPut || r.Method == http.MethodPost):
+			var cfg SelectorConfig
+			dec := json.NewDecoder(r.Body)
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&cfg); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			info, err := reg.SwapSelector(name, &cfg)
+			if err == errUnknownServer {
+				http.Error(w, err.Error()+": "+name, http.StatusNotFound)
+				return
+			} else if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			writeJSON(w, http.StatusOK, info)
+		case sub == "paths" && r.Method == http.MethodGet:
+			tables, err := reg.PathTables(name)
+			if err != nil {
+				http.Error(w, err.Error()+": "+name, http.StatusNotFound)
+				return
+			}
+			writeJSON(w, http.StatusOK, tables)
+		case sub == "weights" && (r.Method == http.MethodPut || r.Method == http.MethodPost):
+			var weights []float64
+			if err := json.NewDecoder(r.Body).Decode(&weights); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			info, err := reg.SetWeights(name, weights)
+			if err == errUnknownServer {
+				http.Error(w, err.Error()+": "+name, http.StatusNotFound)
+				return
+			} else if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			writeJSON(w, http.StatusOK, info)
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	})
+	return m
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+/*
+The admin API is served over plain TCP/IP and should only be bound to localhost
+or a port that is not reachable from the outside
+*/
+func admin_server(sup *Supervisor, addr string, reg *ServerRegistry) {
+	srv := &http.Server{Addr: addr, Handler: reg.Handler()}
+	log.Printf("Admin-Server serves the admin API on: %s\n", addr)
+	sup.Go("admin", srv, srv.ListenAndServe)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"math"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+// the plays of a remote are halved once they exceed this many replies,
+// such that paths whose performance changed are explored again
+const banditWindow = 10000
+
+// BanditReplySelector treats the paths of a remote as the arms of a multi-armed bandit.
+// Every reply is sent over the path with the highest UCB1 score, the reward of a path
+// is derived from the RTT and loss its QUIC packets observed, see PathStats. It balances
+// exploring rarely used paths against exploiting the best one instead of rotating
+// over all paths for a fixed number of replies each. The paths are chosen by the
+// embedded CBReplySelector, only Path differs.
+type BanditReplySelector struct {
+	*CBReplySelector
+	stats *PathStats
+}
+
+// the policy bounds the arms of a remote to the best nr_paths, a nil PathStats
+// learns from DefaultPathStats
+func NewBanditReplySelector(src PathSource, policy PathPolicy, nr_paths int, stats *PathStats) *BanditReplySelector {
+	if stats == nil {
+		stats = DefaultPathStats
+	}
+	brs := &BanditReplySelector{
+		CBReplySelector: NewCBReplySelector(src, policy, nr_paths, 0),
+		stats:           stats,
+	}
+	brs.rrrs.name = "bandit"
+	return brs
+}
+
+// rewards returns the reward of every path within [0, 1]: the share of delivered
+// packets scaled by how close its RTT is to the lowest RTT among the paths.
+// Paths without observations are rewarded optimistically.
+func (brs *BanditReplySelector) rewards(paths pan.PathsMRU) []float64 {
+	perfs := make([]PathPerformance, len(paths))
+	known := make([]bool, len(paths))
+	var minRTT time.Duration
+	for i, p := range paths {
+		perfs[i], known[i] = brs.stats.Performance(p.Fingerprint)
+		if rtt := perfs[i].RTT; known[i] && rtt > 0 && (minRTT == 0 || rtt < minRTT) {
+			minRTT = rtt
+		}
+	}
+	rewards := make([]float64, len(paths))
+	for i := range paths {
+		rewards[i] = 1
+		if !known[i] {
+			continue
+		}
+		rewards[i] -= perfs[i].Loss
+		if perfs[i].RTT > 0 {
+			rewards[i] *= float64(minRTT) / float64(perfs[i].RTT)
+		}
+	}
+	return rewards
+}
+
+// play picks the path with the highest UCB1 score, paths that have not been
+// played yet are tried first
+func play(r *remoteEntry, rewards []float64) *pan.Path {
+	if len(r.plays) > len(r.Paths) || r.plays == nil {
+		// forget the plays of paths that have been removed
+		plays := make(map[pan.PathFingerprint]float64, len(r.Paths))
+		for _, p := range r.Paths {
+			plays[p.Fingerprint] = r.plays[p.Fingerprint]
+		}
+		r.plays = plays
+	}
+	total := 0.0
+	for _, p := range r.Paths {
+		total += r.plays[p.Fingerprint]
+	}
+	best, bestScore := -1, 0.0
+	for i, p := range r.Paths {
+		n := r.plays[p.Fingerprint]
+		if n == 0 {
+			best = i
+			break
+		}
+		score := rewards[i] + math.Sqrt(2*math.Log(total)/n)
+		if best < 0 || score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	chosen := r.Paths[best]
+	r.plays[chosen.Fingerprint] += 1
+	if total+1 > banditWindow {
+		for pf := range r.plays {
+			r.plays[pf] /= 2
+		}
+	}
+	return chosen
+}
+
+func (brs *BanditReplySelector) Path(remote pan.UDPAddr) *pan.Path {
+	rrrs := brs.rrrs
+	rrrs.mtx.Lock()
+	defer rrrs.mtx.Unlock()
+	r, ok := rrrs.remotes[remote]
+	if !ok || len(r.Paths) == 0 {
+		return nil
+	}
+	return play(r, brs.rewards(r.Paths))
+}
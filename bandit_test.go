@@ -0,0 +1,132 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+func TestBanditRewards(t *testing.T) {
+	fast, slow, lossy, unknown := testPath(1, 2), testPath(3, 4), testPath(5, 6), testPath(7, 8)
+	stats := NewPathStats()
+	stats.ObserveRTT(fast.Fingerprint, 10*time.Millisecond)
+	stats.ObserveRTT(slow.Fingerprint, 40*time.Millisecond)
+	stats.ObserveRTT(lossy.Fingerprint, 10*time.Millisecond)
+	stats.ObserveLoss(lossy.Fingerprint)
+
+	brs := NewBanditReplySelector(NewMemoryPathSource(), nil, 4, stats)
+	rewards := brs.rewards(pan.PathsMRU{fast, slow, lossy, unknown})
+	expected := []float64{1, 0.25, 1 - feedbackLossWeight, 1}
+	for i := range expected {
+		if math.Abs(rewards[i]-expected[i]) > 1e-9 {
+			t.Errorf("rewards %v, expected %v", rewards, expected)
+			break
+		}
+	}
+}
+
+func TestBanditPlay(t *testing.T) {
+	a, b, c := testPath(1, 2), testPath(3, 4), testPath(5, 6)
+
+	tests := []struct {
+		name    string
+		paths   pan.PathsMRU
+		plays   map[pan.PathFingerprint]float64
+		rewards []float64
+		// the path of the next reply
+		expected *pan.Path
+	}{
+		{"first path first", pan.PathsMRU{a, b, c}, nil, []float64{0.1, 0.5, 0.9}, a},
+		{"unplayed path first", pan.PathsMRU{a, b, c}, map[pan.PathFingerprint]float64{a.Fingerprint: 5, b.Fingerprint: 5}, []float64{1, 1, 0}, c},
+		{"higher reward", pan.PathsMRU{a, b}, map[pan.PathFingerprint]float64{a.Fingerprint: 10, b.Fingerprint: 10}, []float64{0.5, 0.6}, b},
+		{"rarely played", pan.PathsMRU{a, b}, map[pan.PathFingerprint]float64{a.Fingerprint: 1, b.Fingerprint: 100}, []float64{0.5, 0.9}, a},
+		{"new path", pan.PathsMRU{a, c}, map[pan.PathFingerprint]float64{a.Fingerprint: 10}, []float64{1, 0}, c},
+		{"removed path", pan.PathsMRU{a}, map[pan.PathFingerprint]float64{a.Fingerprint: 10, b.Fingerprint: 10}, []float64{0.5}, a},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRemoteEntry()
+			r.Paths = tt.paths
+			if tt.plays != nil {
+				r.plays = make(map[pan.PathFingerprint]float64)
+				for pf, n := range tt.plays {
+					r.plays[pf] = n
+				}
+			}
+			if p := play(r, tt.rewards); p != tt.expected {
+				t.Fatalf("played %s, expected %s", p.Fingerprint, tt.expected.Fingerprint)
+			}
+			if r.plays[tt.expected.Fingerprint] != tt.plays[tt.expected.Fingerprint]+1 {
+				t.Errorf("played %s %v times", tt.expected.Fingerprint, r.plays[tt.expected.Fingerprint])
+			}
+			// the plays of removed paths are forgotten
+			if len(r.plays) != len(tt.paths) {
+				t.Errorf("plays of %d paths kept, expected %d", len(r.plays), len(tt.paths))
+			}
+		})
+	}
+}
+
+func TestBanditConverges(t *testing.T) {
+	r := newRemoteEntry()
+	r.Paths = pan.PathsMRU{testPath(1, 2), testPath(3, 4), testPath(5, 6)}
+	rewards := []float64{0.2, 0.9, 0.5}
+	count := make(map[*pan.Path]int)
+	for i := 0; i < 1000; i++ {
+		count[play(r, rewards)]++
+	}
+	best := r.Paths[1]
+	for _, p := range r.Paths {
+		if count[p] == 0 {
+			t.Errorf("path %s never explored", p.Fingerprint)
+		}
+		if p != best && count[p] >= count[best] {
+			t.Errorf("path %s played %d times, the best path only %d times", p.Fingerprint, count[p], count[best])
+		}
+	}
+	if count[best] < 500 {
+		t.Errorf("best path played %d of 1000 times", count[best])
+	}
+}
+
+func TestBanditWindow(t *testing.T) {
+	a, b := testPath(1, 2), testPath(3, 4)
+	r := newRemoteEntry()
+	r.Paths = pan.PathsMRU{a, b}
+	r.plays = map[pan.PathFingerprint]float64{a.Fingerprint: banditWindow / 2, b.Fingerprint: banditWindow / 2}
+
+	p := play(r, []float64{1, 0})
+	if total := r.plays[a.Fingerprint] + r.plays[b.Fingerprint]; total != (banditWindow+1)/2.0 {
+		t.Errorf("%v plays after exceeding the window, expected them halved", total)
+	}
+	if p != a || r.plays[a.Fingerprint] != (banditWindow/2+1)/2.0 {
+		t.Errorf("played %s %v times", p.Fingerprint, r.plays[p.Fingerprint])
+	}
+}
+
+func TestBanditReplySelector(t *testing.T) {
+	fast, slow := testPath(1, 2), testPath(3, 4)
+	mps := NewMemoryPathSource()
+	mps.SetPaths(testRemoteIA, []*pan.Path{slow, fast})
+	stats := NewPathStats()
+	stats.ObserveRTT(fast.Fingerprint, 10*time.Millisecond)
+	stats.ObserveRTT(slow.Fingerprint, 50*time.Millisecond)
+
+	brs := NewBanditReplySelector(mps, nil, 2, stats)
+	remote := testRemote(1)
+	if p := brs.Path(remote); p != nil {
+		t.Fatalf("reply over %s before the remote was recorded", p.Fingerprint)
+	}
+	brs.Record(remote, fast)
+	// every arm is tried once, then the faster path is preferred
+	expectPaths(t, brs, remote, slow, fast)
+	count := make(map[*pan.Path]int)
+	for i := 0; i < 100; i++ {
+		count[brs.Path(remote)]++
+	}
+	if count[fast] <= count[slow] {
+		t.Errorf("fast path played %d times, slow path %d times", count[fast], count[slow])
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// certificate files are checked for changes at most this often
+const certCheckPeriod = 5 * time.Second
+
+// CertStore holds the TLS certificates shared by the QUIC listeners of all servers.
+// It selects the certificate by the SNI of the client and reloads certificates
+// whose files changed, so renewed certificates are used without a restart.
+type CertStore struct {
+	mtx     sync.RWMutex
+	entries []*certEntry
+	checked time.Time
+}
+
+type certEntry struct {
+	certFile string
+	keyFile  string
+	cert     *tls.Certificate
+	// latest modification time of both files when they were loaded
+	modTime time.Time
+}
+
+func NewCertStore() *CertStore {
+	return &CertStore{}
+}
+
+// NewCertStoreFromFiles loads the certificate chain and key of every pair of files
+func NewCertStoreFromFiles(certFiles, keyFiles []string) (*CertStore, error) {
+	if len(certFiles) != len(keyFiles) {
+		return nil, fmt.Errorf("got %d certificate(s) but %d key(s)", len(certFiles), len(keyFiles))
+	}
+	cs := NewCertStore()
+	for i := range certFiles {
+		if err := cs.Add(certFiles[i], keyFiles[i]); err != nil {
+			return nil, err
+		}
+	}
+	return cs, nil
+}
+
+// Add loads a PEM encoded certificate chain and its key. The first added certificate
+// is served to clients whose SNI matches none of the certificates.
+func (cs *CertStore) Add(certFile, keyFile string) error {
+	e := &certEntry{certFile: certFile, keyFile: keyFile}
+	if err := e.load(); err != nil {
+		return err
+	}
+	cs.mtx.Lock()
+	defer cs.mtx.Unlock()
+	cs.entries = append(cs.entries, e)
+	return nil
+}
+
+// Len returns the number of certificates in the store
+func (cs *CertStore) Len() int {
+	cs.mtx.RLock()
+	defer cs.mtx.RUnlock()
+	return len(cs.entries)
+}
+
+// TLSConfig returns a TLS configuration serving the certificates of the store.
+// It returns nil for a nil or empty store, such that listeners fall back to a
+// self-signed certificate.
+func (cs *CertStore) TLSConfig() *tls.Config {
+	if cs == nil || cs.Len() == 0 {
+		return nil
+	}
+	return &tls.Config{GetCertificate: cs.GetCertificate}
+}
+
+// GetCertificate implements tls.Config.GetCertificate
+func (cs *CertStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cs.reload(time.Now())
+	cs.mtx.RLock()
+	defer cs.mtx.RUnlock()
+	if len(cs.entries) == 0 {
+		return nil, errors.New("no certificates")
+	}
+	for _, e := range cs.entries {
+		if hello.SupportsCertificate(e.cert) == nil {
+			return e.cert, nil
+		}
+	}
+	return cs.entries[0].cert, nil
+}
+
+// reload reloads the certificates whose files changed since they were loaded.
+// A certificate that fails to load, e.g. while its files are being replaced,
+// is kept and tried again on the next check.
+func (cs *CertStore) reload(now time.Time) {
+	cs.mtx.RLock()
+	due := now.Sub(cs.checked) >= certCheckPeriod
+	cs.mtx.RUnlock()
+	if !due {
+		return
+	}
+
+	cs.mtx.Lock()
+	defer cs.mtx.Unlock()
+	if now.Sub(cs.checked) < certCheckPeriod {
+		return
+	}
+	cs.checked = now
+	for _, e := range cs.entries {
+		modTime, err := e.modified()
+		if err != nil || !modTime.After(e.modTime) {
+			continue
+		}
+		if err := e.load(); err != nil {
+			log.Printf("Certificates: keeping the previous certificate of %s: %v\n", e.certFile, err)
+			continue
+		}
+		log.Printf("Certificates: reloaded %s\n", e.certFile)
+	}
+}
+
+func (e *certEntry) load() error {
+	modTime, err := e.modified()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(e.certFile, e.keyFile)
+	if err != nil {
+		return fmt.Errorf("loading certificate %s: %w", e.certFile, err)
+	}
+	// the parsed leaf is needed to match the SNI of clients
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("parsing certificate %s: %w", e.certFile, err)
+	}
+	e.cert = &cert
+	e.modTime = modTime
+	return nil
+}
+
+// modified returns the latest modification time of the certificate and key file
+func (e *certEntry) modified() (time.Time, error) {
+	certInfo, err := os.Stat(e.certFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+	keyInfo, err := os.Stat(e.keyFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if keyInfo.ModTime().After(certInfo.ModTime()) {
+		return keyInfo.ModTime(), nil
+	}
+	return certInfo.ModTime(), nil
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert writes a self-signed certificate for the DNS names and its key
+// to dir and returns the file names
+func writeTestCert(t *testing.T, dir, name string, serial int64, dnsNames ...string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// testHello returns the hello of a TLS 1.3 client connecting to serverName
+func testHello(serverName string) *tls.ClientHelloInfo {
+	return &tls.ClientHelloInfo{
+		ServerName:        serverName,
+		SupportedVersions: []uint16{tls.VersionTLS13},
+		SignatureSchemes:  []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256},
+	}
+}
+
+// serialOf returns the serial number of the certificate served to serverName
+func serialOf(t *testing.T, cs *CertStore, serverName string) int64 {
+	t.Helper()
+	cert, err := cs.GetCertificate(testHello(serverName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert.Leaf.SerialNumber.Int64()
+}
+
+func TestCertStoreGetCertificate(t *testing.T) {
+	dir := t.TempDir()
+	cert1, key1 := writeTestCert(t, dir, "a", 1, "a.example")
+	cert2, key2 := writeTestCert(t, dir, "b", 2, "b.example", "*.c.example")
+	cs, err := NewCertStoreFromFiles([]string{cert1, cert2}, []string{key1, key2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		serverName string
+		serial     int64
+	}{
+		{"a.example", 1},
+		{"b.example", 2},
+		{"www.c.example", 2},
+		// the first certificate is served to unknown names and clients without SNI
+		{"unknown.example", 1},
+		{"", 1},
+	}
+	for _, tt := range tests {
+		if serial := serialOf(t, cs, tt.serverName); serial != tt.serial {
+			t.Errorf("certificate %d served to %q, expected %d", serial, tt.serverName, tt.serial)
+		}
+	}
+	if cfg := cs.TLSConfig(); cfg == nil || cfg.GetCertificate == nil {
+		t.Error("no TLS configuration serving the certificates")
+	}
+}
+
+func TestCertStoreSelfSigned(t *testing.T) {
+	// without certificates listeners fall back to a self-signed certificate
+	var nilStore *CertStore
+	if nilStore.TLSConfig() != nil || NewCertStore().TLSConfig() != nil {
+		t.Error("TLS configuration without certificates")
+	}
+	if _, err := NewCertStore().GetCertificate(testHello("a.example")); err == nil {
+		t.Error("certificate served from an empty store")
+	}
+
+	dir := t.TempDir()
+	cert1, key1 := writeTestCert(t, dir, "a", 1, "a.example")
+	if _, err := NewCertStoreFromFiles([]string{cert1}, nil); err == nil {
+		t.Error("certificate without key accepted")
+	}
+	if _, err := NewCertStoreFromFiles([]string{cert1}, []string{filepath.Join(dir, "missing.key")}); err == nil {
+		t.Error("missing key file accepted")
+	}
+	if _, err := NewCertStoreFromFiles([]string{key1}, []string{key1}); err == nil {
+		t.Error("key accepted as certificate")
+	}
+}
+
+func TestCertStoreReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCert(t, dir, "a", 1, "a.example")
+	cs, err := NewCertStoreFromFiles([]string{certFile}, []string{keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	cs.reload(now)
+
+	// renew the certificate, its files are newer than the loaded ones
+	writeTestCert(t, dir, "a", 2, "a.example")
+	renewed := now.Add(time.Minute)
+	for _, f := range []string{certFile, keyFile} {
+		if err := os.Chtimes(f, renewed, renewed); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the files are checked at most every certCheckPeriod
+	cs.reload(now.Add(certCheckPeriod / 2))
+	if serial := serialOf(t, cs, "a.example"); serial != 1 {
+		t.Errorf("certificate %d served before the check period passed, expected 1", serial)
+	}
+	cs.reload(now.Add(certCheckPeriod))
+	if serial := serialOf(t, cs, "a.example"); serial != 2 {
+		t.Errorf("certificate %d served after the renewal, expected 2", serial)
+	}
+
+	// a certificate that fails to load keeps the previous one
+	if err := os.WriteFile(certFile, []byte("garbage"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	broken := now.Add(2 * time.Minute)
+	if err := os.Chtimes(certFile, broken, broken); err != nil {
+		t.Fatal(err)
+	}
+	cs.reload(now.Add(2 * certCheckPeriod))
+	if serial := serialOf(t, cs, "a.example"); serial != 2 {
+		t.Errorf("certificate %d served after a failed reload, expected 2", serial)
+	}
+}
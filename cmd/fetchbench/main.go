@@ -0,0 +1,410 @@
+package main
+
+/* Go counterpart of measurement_automation.py, dials the servers directly over SCION
+   instead of going through the scion-skip proxy, so the fetch times contain no proxy overhead
+
+   -> run program in terminal like this:
+
+      go run ./cmd/fetchbench 100 p
+      go run ./cmd/fetchbench 100 s 1
+
+   first argument => how many fetch runs to approximate stable average
+   second argument => flag for runtime mode s/0 = Sequential, p/1 = Parallel
+   third argument => flag to enable detailed stats output (mainly for debug)
+   -> writes <mode>_fetch_times.csv like measurement_automation.py, plot it with plot_results.py,
+      and <mode>_fetch_paths.csv with the paths every fetch was sent over
+   -> the paths of the requests are chosen with -selector and -policy, see selectors.go
+*/
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsec-ethz/scion-apps/pkg/quicutil"
+	"github.com/netsec-ethz/scion-apps/pkg/shttp"
+	"github.com/nils-treuheit/scion-cdn/internal/simnet"
+)
+
+// fetch is the outcome of one fetch of a URL, failed fetches have no time but an error
+type fetch struct {
+	ok   bool
+	time float64
+	path string
+	err  error
+}
+
+// pathConn remembers the paths of the stream an HTTP request is sent on
+type pathConn struct {
+	net.Conn
+	selector *recordingSelector
+}
+
+// path returns the fingerprints of the paths the connection sent its requests over
+func (c *pathConn) path() string {
+	return c.selector.paths()
+}
+
+// dial opens an insecure single stream QUIC connection over SCION, or the simulated network,
+// like shttp.Dialer, choosing the paths of the requests as configured
+func (cc *clientConfig) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	tlsCfg := &tls.Config{
+		NextProtos:         []string{quicutil.SingleStreamProto},
+		InsecureSkipVerify: true,
+	}
+	selector := &recordingSelector{Selector: cc.selector()}
+	var session *pan.QUICSession
+	if cc.network != nil {
+		// the servers of the simulated network are addressed by their loopback address
+		ap, err := netip.ParseAddrPort(addr)
+		if err != nil {
+			return nil, fmt.Errorf("%s is no IP address of the simulated network: %w", addr, err)
+		}
+		remote := pan.UDPAddr{IA: cc.network.ServerIA(), IP: ap.Addr(), Port: ap.Port()}
+		if session, err = cc.network.DialQUIC(ctx, netip.AddrPort{}, remote, cc.policy, selector, addr, tlsCfg, nil); err != nil {
+			return nil, err
+		}
+	} else {
+		remote, err := pan.ResolveUDPAddr(ctx, pan.UnmangleSCIONAddr(addr))
+		if err != nil {
+			return nil, err
+		}
+		if session, err = pan.DialQUIC(ctx, netip.AddrPort{}, remote, cc.policy, selector, addr, tlsCfg, nil); err != nil {
+			return nil, err
+		}
+	}
+	stream, err := quicutil.NewSingleStream(session)
+	if err != nil {
+		_ = session.CloseWithError(0, "")
+		return nil, err
+	}
+	return &pathConn{Conn: stream, selector: selector}, nil
+}
+
+// newClient dials a new connection for every fetch, like every requests.get of the python script
+func newClient(cc *clientConfig) *http.Client {
+	transport := shttp.DefaultTransport.Clone()
+	transport.Proxy = nil
+	transport.DialContext = cc.dial
+	transport.DisableKeepAlives = true
+	return &http.Client{Transport: transport}
+}
+
+// fetchAndTime fetches the whole body of url and measures how long it took
+func fetchAndTime(client *http.Client, url string) fetch {
+	var conn *pathConn
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			conn, _ = info.Conn.(*pathConn)
+		},
+	}
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(context.Background(), trace),
+		http.MethodGet, shttp.MangleSCIONAddrURL(url), nil)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	start := time.Now()
+	res, err := client.Do(req)
+	if err != nil {
+		return fetch{err: err}
+	}
+	_, err = io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+	if err == nil && res.StatusCode >= 400 {
+		err = fmt.Errorf("status %s", res.Status)
+	}
+	f := fetch{ok: err == nil, time: time.Since(start).Seconds(), err: err}
+	if conn != nil {
+		f.path = conn.path()
+	}
+	return f
+}
+
+func fetchURLsInParallel(cc *clientConfig, urls []string, runs int) [][]fetch {
+	data := make([][]fetch, len(urls))
+	var wg sync.WaitGroup
+	for i, url := range urls {
+		wg.Add(1)
+		go func(i int, url string) {
+			defer wg.Done()
+			client := newClient(cc)
+			col := make([]fetch, runs)
+			for id := range col {
+				col[id] = fetchAndTime(client, url)
+			}
+			data[i] = col
+		}(i, url)
+	}
+	wg.Wait()
+	return data
+}
+
+func fetchURLsSequential(cc *clientConfig, urls []string, runs int, debug bool) [][]fetch {
+	client := newClient(cc)
+	data := make([][]fetch, len(urls))
+	for i, url := range urls {
+		col := make([]fetch, runs)
+		for id := range col {
+			col[id] = fetchAndTime(client, url)
+		}
+		data[i] = col
+		if debug {
+			printStats(url, col)
+		}
+	}
+	return data
+}
+
+func printStats(url string, col []fetch) {
+	var times []float64
+	sum := 0.0
+	for _, f := range col {
+		if f.ok {
+			times = append(times, f.time)
+			sum += f.time
+		}
+	}
+	if len(times) == 0 {
+		fmt.Printf("%s was not fetched succesfully!\n", url)
+		printFailures(col)
+		fmt.Println()
+		return
+	}
+	sort.Float64s(times)
+	mean := sum / float64(len(times))
+	median := times[len(times)/2]
+	if len(times)%2 == 0 {
+		median = (times[len(times)/2-1] + times[len(times)/2]) / 2
+	}
+	variance := 0.0
+	for _, t := range times {
+		variance += (t - mean) * (t - mean)
+	}
+	std := math.Sqrt(variance / float64(len(times)))
+	fmt.Printf("It took %.9f seconds to fetch benchmark %s\n", sum, url)
+	fmt.Printf("-> The average fetch time was %.9f seconds\n", mean)
+	fmt.Printf("-> The median fetch time was %.9f seconds\n", median)
+	fmt.Printf("-> The standard deviation was %.6f\n", std)
+	fmt.Printf("-> The fastest fetch took %.9f\n", times[0])
+	fmt.Printf("-> The slowest fetch took %.9f\n", times[len(times)-1])
+	fmt.Printf("-> Was fetched %d succesfully!\n", len(times))
+	printFailures(col)
+	fmt.Println()
+}
+
+// printFailures prints how often each error made a fetch fail
+func printFailures(col []fetch) {
+	counts := make(map[string]int)
+	var errs []string
+	for _, f := range col {
+		if f.err == nil {
+			continue
+		}
+		msg := f.err.Error()
+		if counts[msg] == 0 {
+			errs = append(errs, msg)
+		}
+		counts[msg]++
+	}
+	for _, msg := range errs {
+		fmt.Printf("-> Failed %d times: %s\n", counts[msg], msg)
+	}
+}
+
+// countFailures returns the number of failed fetches of all URLs
+func countFailures(data [][]fetch) int {
+	failed := 0
+	for _, col := range data {
+		for _, f := range col {
+			if !f.ok {
+				failed++
+			}
+		}
+	}
+	return failed
+}
+
+// writeCSV writes one column per URL and one fetch_<id> row per run in the layout
+// pandas writes the fetch times
+func writeCSV(file string, urls []string, data [][]fetch, cell func(f fetch) string) error {
+	out, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	w := csv.NewWriter(out)
+	if err := w.Write(append([]string{""}, urls...)); err != nil {
+		return err
+	}
+	runs := 0
+	if len(data) > 0 {
+		runs = len(data[0])
+	}
+	for id := 0; id < runs; id++ {
+		row := []string{fmt.Sprintf("fetch_%d", id)}
+		for _, col := range data {
+			row = append(row, cell(col[id]))
+		}
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func main() {
+	website := flag.String("website", "http://www.scion-sample.org", "The website served by the web server")
+	fileServPort := flag.String("fileServPort", "8899", "The port of the streaming content server")
+	contentServPort := flag.String("contentServPort", "8181", "The port of the content server")
+	outDir := flag.String("outDir", ".", "The directory to write the CSV files to")
+	// path choice of the requests, see selectors.go
+	selector := flag.String("selector", "default", "The path selector of the requests: default, rr, selective or range")
+	policyName := flag.String("policy", "", "The path policy of the requests: mtu, latency, bandwidth or hops, empty for the order of the daemon")
+	nrPaths := flag.Int("paths", 5, "The number of paths the rr selector rotates over")
+	pathIDs := flag.String("pathIDs", "", "Comma separated path IDs of the selective selector or start,end of the range selector")
+	iterations := flag.Int("iterations", 1000, "The packets over one path before rotating to the next")
+	minMTU := flag.Uint("minMTU", 1400, "The minimum MTU of the mtu policy")
+	maxLatency := flag.Duration("maxLatency", 25*time.Millisecond, "The maximum latency of the latency policy, 0 for any")
+	minBandwidth := flag.Uint64("minBandwidth", 100000, "The minimum bandwidth in Kbit/s of the bandwidth policy")
+	topologyFile := flag.String("topology", "", "A topology file of a simulated network to dial the servers over instead of SCION, as passed to the servers")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [runs] [s|p] [debug] [flags]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	// flags follow the positional arguments of measurement_automation.py
+	args := os.Args[1:]
+	var pos []string
+	for len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		pos, args = append(pos, args[0]), args[1:]
+	}
+	_ = flag.CommandLine.Parse(args)
+
+	runs := 100
+	parallel := false
+	debug := true
+	if len(pos) > 0 {
+		var err error
+		if runs, err = strconv.Atoi(pos[0]); err != nil || runs < 1 {
+			log.Fatalf("invalid number of runs %q", pos[0])
+		}
+	}
+	if len(pos) > 1 && (strings.Contains(strings.ToLower(pos[1]), "p") || pos[1] == "1") {
+		parallel = true
+	}
+	if parallel || (len(pos) > 2 && pos[2] == "0") {
+		debug = false
+	}
+
+	var ids []int
+	for _, id := range strings.Split(*pathIDs, ",") {
+		if id == "" {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(id))
+		if err != nil {
+			log.Fatalf("invalid path id %q", id)
+		}
+		ids = append(ids, n)
+	}
+	if *minMTU > math.MaxUint16 {
+		log.Fatalf("invalid minimum MTU %d", *minMTU)
+	}
+	policy, err := newPolicy(*policyName, uint16(*minMTU), *maxLatency, *minBandwidth)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	cc, err := newClientConfig(*selector, policy, *nrPaths, ids, *iterations)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	if *topologyFile != "" {
+		topo, err := simnet.LoadTopology(*topologyFile)
+		if err != nil {
+			log.Fatalf("%s", err)
+		}
+		if cc.network, err = simnet.NewNetwork(topo); err != nil {
+			log.Fatalf("%s", err)
+		}
+	}
+
+	// the file and content servers are reached on the host of the website
+	site, err := url.Parse(*website)
+	if err != nil {
+		log.Fatalf("invalid website %q: %s", *website, err)
+	}
+	withPort := func(port string) string {
+		u := *site
+		u.Host = net.JoinHostPort(u.Hostname(), port)
+		return u.String()
+	}
+
+	urls := []string{*website + "/", *website + "/favicon.ico", *website + "/hello-world",
+		*website + "/sample-json", *website + "/sample-text"}
+	for _, suffix := range []string{"SCION_Lec.m3u8", "SCION_Lec_100.m4s"} {
+		urls = append(urls, withPort(*fileServPort)+"/"+suffix)
+	}
+	for _, suffix := range []string{"sample-image", "sample-gif", "sample-audio", "sample-video"} {
+		urls = append(urls, withPort(*contentServPort)+"/"+suffix)
+	}
+
+	mode, prefix := "Sequential", "seq_"
+	if parallel {
+		mode, prefix = "Parallel", "par_"
+	}
+	debugInfo := "without"
+	if debug {
+		debugInfo = "with"
+	}
+	fmt.Printf("Run Fetch Program %s with %s debug output\n", strings.ToLower(mode), debugInfo)
+
+	start := time.Now()
+	var data [][]fetch
+	if parallel {
+		data = fetchURLsInParallel(cc, urls, runs)
+	} else {
+		data = fetchURLsSequential(cc, urls, runs, debug)
+	}
+	fmt.Printf("The whole %s Fetching Benchmark took %v seconds.\n", mode, time.Since(start).Seconds())
+	if failed := countFailures(data); failed > 0 {
+		fmt.Printf("%d of %d fetches failed.\n", failed, len(urls)*runs)
+	}
+
+	timesFile := filepath.Join(*outDir, prefix+"fetch_times.csv")
+	err = writeCSV(timesFile, urls, data, func(f fetch) string {
+		// failed fetches are left empty like the NaN values of pandas
+		if !f.ok {
+			return ""
+		}
+		return strconv.FormatFloat(f.time, 'f', -1, 64)
+	})
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	pathsFile := filepath.Join(*outDir, prefix+"fetch_paths.csv")
+	err = writeCSV(pathsFile, urls, data, func(f fetch) string {
+		return f.path
+	})
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	fmt.Printf("Wrote %s and %s, plot them with: python plot_results.py %s\n", timesFile, pathsFile, timesFile)
+}
@@ -0,0 +1,270 @@
+package main
+
+/* Client side counterparts of the reply selectors of the servers, such that the request
+   direction can be varied independently of the reply direction. The policy filters and
+   orders the paths of a connection, the selector rotates over them. */
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/nils-treuheit/scion-cdn/internal/simnet"
+)
+
+// filterFunc keeps the paths with metadata fulfilling the condition, as the policies of the servers
+func filterFunc(cond func(pm *pan.PathMetadata) bool) pan.Policy {
+	return pan.PolicyFunc(func(paths []*pan.Path) []*pan.Path {
+		var filtered []*pan.Path
+		for _, p := range paths {
+			if p.Metadata != nil && cond(p.Metadata) {
+				filtered = append(filtered, p)
+			}
+		}
+		return filtered
+	})
+}
+
+// newPolicy mirrors the path policies of the servers: mtu keeps paths with an MTU of at
+// least minMTU, smallest first, latency paths with a latency of at most maxLatency, lowest
+// first, bandwidth paths with at least minBandwidth Kbit/s, highest first, and hops orders
+// the paths by their number of hops. An empty name keeps the order of the daemon.
+func newPolicy(name string, minMTU uint16, maxLatency time.Duration, minBandwidth uint64) (pan.Policy, error) {
+	switch name {
+	case "":
+		return nil, nil
+	case "mtu":
+		return pan.PolicyChain{
+			filterFunc(func(pm *pan.PathMetadata) bool { return pm.MTU >= minMTU }),
+			pan.PolicyFunc(func(paths []*pan.Path) []*pan.Path {
+				sort.SliceStable(paths, func(i, j int) bool {
+					return paths[i].Metadata.MTU < paths[j].Metadata.MTU
+				})
+				return paths
+			}),
+		}, nil
+	case "latency":
+		return pan.PolicyChain{
+			filterFunc(func(pm *pan.PathMetadata) bool {
+				lat, _ := pm.LatencySum()
+				return maxLatency == 0 || lat <= maxLatency
+			}),
+			pan.LowestLatency{},
+		}, nil
+	case "bandwidth":
+		return pan.PolicyChain{
+			filterFunc(func(pm *pan.PathMetadata) bool {
+				bw, _ := pm.BandwidthMin()
+				return bw >= minBandwidth
+			}),
+			pan.HighestBandwidth{},
+		}, nil
+	case "hops":
+		return pan.PolicyChain{
+			filterFunc(func(pm *pan.PathMetadata) bool { return true }),
+			pan.LeastHops{},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown policy %q, expected mtu, latency, bandwidth or hops", name)
+	}
+}
+
+// rotatingSelector sends its packets over one path before rotating to the next of the
+// paths choose picks from the paths of the policy, like the RRReplySelector of the servers
+type rotatingSelector struct {
+	mtx     sync.Mutex
+	choose  func(paths []*pan.Path) []*pan.Path
+	its     int
+	paths   []*pan.Path
+	idx     int
+	itcount int
+}
+
+// newRRSelector rotates over the first nr_rr_paths paths
+func newRRSelector(nr_rr_paths int, rep_its int) *rotatingSelector {
+	return &rotatingSelector{
+		choose: func(paths []*pan.Path) []*pan.Path {
+			if len(paths) > nr_rr_paths {
+				return paths[:nr_rr_paths]
+			}
+			return paths
+		},
+		its: rep_its,
+	}
+}
+
+// newSelectivePathSelector rotates over the paths with the given IDs, i.e. positions
+// in the order of the policy, like the StrategicReplySelector of the servers
+func newSelectivePathSelector(pathIDs []int, rep_its int) *rotatingSelector {
+	return &rotatingSelector{
+		choose: func(paths []*pan.Path) []*pan.Path {
+			var chosen []*pan.Path
+			for _, idx := range pathIDs {
+				if len(paths) > idx {
+					chosen = append(chosen, paths[idx])
+				}
+			}
+			return chosen
+		},
+		its: rep_its,
+	}
+}
+
+// newPathRangeSelector rotates over the paths with the IDs in [start, end)
+func newPathRangeSelector(start, end int, rep_its int) *rotatingSelector {
+	var pathIDs []int
+	for val := start; val < end; val++ {
+		pathIDs = append(pathIDs, val)
+	}
+	return newSelectivePathSelector(pathIDs, rep_its)
+}
+
+func (s *rotatingSelector) Path() *pan.Path {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if len(s.paths) == 0 {
+		return nil
+	}
+	if s.itcount < s.its {
+		s.itcount += 1
+	} else {
+		s.itcount = 0
+		s.idx += 1
+	}
+	if s.idx >= len(s.paths) {
+		s.idx = 0
+	}
+	return s.paths[s.idx]
+}
+
+func (s *rotatingSelector) Initialize(local, remote pan.UDPAddr, paths []*pan.Path) {
+	s.Refresh(paths)
+}
+
+// Refresh restarts the rotation on the refreshed paths
+func (s *rotatingSelector) Refresh(paths []*pan.Path) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.paths = s.choose(paths)
+	s.idx = 0
+	s.itcount = 0
+}
+
+// PathDown removes the affected paths until the next refresh, unless no path would be left
+func (s *rotatingSelector) PathDown(pf pan.PathFingerprint, pi pan.PathInterface) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	var kept []*pan.Path
+	for _, p := range s.paths {
+		if p.Fingerprint != pf && !isInterfaceOnPath(p, pi) {
+			kept = append(kept, p)
+		}
+	}
+	if len(kept) > 0 && len(kept) < len(s.paths) {
+		s.paths = kept
+		s.idx = 0
+		s.itcount = 0
+	}
+}
+
+func (s *rotatingSelector) Close() error {
+	return nil
+}
+
+func isInterfaceOnPath(p *pan.Path, pi pan.PathInterface) bool {
+	if p.Metadata == nil {
+		return false
+	}
+	for _, c := range p.Metadata.Interfaces {
+		if c == pi {
+			return true
+		}
+	}
+	return false
+}
+
+// recordingSelector remembers the paths a connection sent its packets over
+type recordingSelector struct {
+	pan.Selector
+	mtx  sync.Mutex
+	used []pan.PathFingerprint
+}
+
+func (s *recordingSelector) Path() *pan.Path {
+	p := s.Selector.Path()
+	if p == nil {
+		return nil
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for _, pf := range s.used {
+		if pf == p.Fingerprint {
+			return p
+		}
+	}
+	s.used = append(s.used, p.Fingerprint)
+	return p
+}
+
+// paths returns the fingerprints of the used paths in the order they were first used
+func (s *recordingSelector) paths() string {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if len(s.used) == 0 {
+		// remotes in the local AS are reached without a path
+		return "local"
+	}
+	fps := make([]string, len(s.used))
+	for i, pf := range s.used {
+		fps[i] = string(pf)
+	}
+	return strings.Join(fps, ";")
+}
+
+// clientConfig describes the path choice of the requests
+type clientConfig struct {
+	policy   pan.Policy
+	selector func() pan.Selector
+	// dials over the simulated network instead of SCION if set
+	network *simnet.Network
+}
+
+// newClientConfig mirrors the selector types of the server configuration: default keeps
+// the first path of the policy as long as it is up, rr rotates over the first paths,
+// selective over the given path IDs and range over the path IDs [start, end)
+func newClientConfig(selector string, policy pan.Policy, nr_paths int, pathIDs []int, rep_its int) (*clientConfig, error) {
+	cc := &clientConfig{policy: policy}
+	switch selector {
+	case "default":
+		cc.selector = func() pan.Selector { return pan.NewDefaultSelector() }
+	case "rr":
+		if nr_paths < 1 {
+			return nil, fmt.Errorf("rr selector needs paths >= 1")
+		}
+		cc.selector = func() pan.Selector { return newRRSelector(nr_paths, rep_its) }
+	case "selective":
+		if len(pathIDs) == 0 {
+			return nil, fmt.Errorf("selective selector needs path IDs")
+		}
+		cc.selector = func() pan.Selector { return newSelectivePathSelector(pathIDs, rep_its) }
+	case "range":
+		if len(pathIDs) != 2 || pathIDs[0] < 0 || pathIDs[0] >= pathIDs[1] {
+			return nil, fmt.Errorf("range selector needs path IDs start,end with 0 <= start < end")
+		}
+		cc.selector = func() pan.Selector { return newPathRangeSelector(pathIDs[0], pathIDs[1], rep_its) }
+	default:
+		return nil, fmt.Errorf("unknown selector %q, expected default, rr, selective or range", selector)
+	}
+	if rep_its < 0 {
+		return nil, fmt.Errorf("negative iterations")
+	}
+	for _, id := range pathIDs {
+		if id < 0 {
+			return nil, fmt.Errorf("negative path id %d", id)
+		}
+	}
+	return cc, nil
+}
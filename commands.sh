@@ -22,5 +22,5 @@ git clone https://github.com/Nils-Treuheit/SCION-CDN
 
 # runtime
 cd ~/scion-apps && ./bin/scion-skip
-ssh -t <user>@<ip> "cd ~/SCION-CDN && go run scion_server.go selectors.go servers.go <mode>"
+ssh -t <user>@<ip> "cd ~/SCION-CDN && go run . <mode>"
 cd ~/SCION-CDN && python measurement_automation.py <reps> <mode> <debug>
@@ -0,0 +1,552 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/nils-treuheit/scion-cdn/internal/simnet"
+)
+
+// Config describes the served topology, see configs/ for examples
+type Config struct {
+	// optional TCP address of the admin API, e.g. "127.0.0.1:9090"
+	Admin string `json:"admin,omitempty"`
+	// TLS certificates shared by the QUIC listeners of all servers, chosen by the
+	// SNI of the client, without any the servers use a self-signed certificate
+	Certificates []CertConfig   `json:"certificates,omitempty"`
+	Servers      []ServerConfig `json:"servers"`
+}
+
+// CertConfig names the PEM files of a certificate chain and its key
+type CertConfig struct {
+	Cert string `json:"cert"`
+	Key  string `json:"key"`
+}
+
+type ServerConfig struct {
+	Name string `json:"name"`
+	// one of file, content or web
+	Type string `json:"type"`
+	Port int    `json:"port"`
+	Dir  string `json:"dir"`
+	// single-stream (default) or http3
+	Protocol Protocol `json:"protocol,omitempty"`
+	// additional routes serving files of Dir, URL path to file name
+	Routes   map[string]string `json:"routes,omitempty"`
+	TLS      *TLSConfig        `json:"tls,omitempty"`
+	Selector SelectorConfig    `json:"selector"`
+}
+
+// TLSConfig enables the optional https port of a web server,
+// the optional certificate is added to the shared certificates
+type TLSConfig struct {
+	Port int    `json:"port"`
+	Cert string `json:"cert,omitempty"`
+	Key  string `json:"key,omitempty"`
+}
+
+type SelectorConfig struct {
+	// one of default, rr, cb, selective, range, striping, bandit, weighted or mux
+	Type   string        `json:"type"`
+	Policy *PolicyConfig `json:"policy,omitempty"`
+	// number of rotated paths of rr and cb selectors, striped paths of striping selectors,
+	// arms of bandit selectors or weighted paths of weighted selectors
+	Paths int `json:"paths,omitempty"`
+	// path IDs of selective and weighted selectors or [start, end) of range selectors
+	PathIDs []int `json:"path_ids,omitempty"`
+	// share of the replies of the i-th path ID, or of the i-th best path without path_ids,
+	// of weighted selectors
+	Weights []float64 `json:"weights,omitempty"`
+	// derives the weights of weighted selectors from the paths instead,
+	// one of inverse_latency or bandwidth
+	WeightBy string `json:"weight_by,omitempty"`
+	// replies over one path before rotating to the next
+	Iterations      int       `json:"iterations,omitempty"`
+	RefreshInterval *Duration `json:"refresh_interval,omitempty"`
+	IdleTimeout     *Duration `json:"idle_timeout,omitempty"`
+	MaxRemotes      *int      `json:"max_remotes,omitempty"`
+	// probes the candidate paths, latency policies then prefer the measured latencies.
+	// Paths are only re-sorted on refresh, so consider a shorter refresh_interval.
+	Probe *ProbeConfig `json:"probe,omitempty"`
+	// latency and loss policies prefer the performance the QUIC connections observed
+	// per path, over the probed one if both are enabled
+	Feedback bool `json:"feedback,omitempty"`
+	// per content class selectors of mux selectors
+	Fallback ContentClass                     `json:"fallback,omitempty"`
+	Classes  map[ContentClass]*SelectorConfig `json:"classes,omitempty"`
+	Routes   map[string]ContentClass          `json:"routes,omitempty"`
+}
+
+// ProbeConfig enables active probing of the paths, zero values use the defaults
+type ProbeConfig struct {
+	Interval Duration `json:"interval,omitempty"`
+	Timeout  Duration `json:"timeout,omitempty"`
+}
+
+type PolicyConfig struct {
+	// one of mtu, latency, loss, bandwidth, hops, disjoint, and, or or then
+	Type         string   `json:"type"`
+	MinMTU       uint16   `json:"min_mtu,omitempty"`
+	MaxLatency   Duration `json:"max_latency,omitempty"`
+	MaxLoss      float64  `json:"max_loss,omitempty"`
+	MinBandwidth uint64   `json:"min_bandwidth,omitempty"`
+	MaxHops      int      `json:"max_hops,omitempty"`
+	// links or, with interfaces set, interfaces disjoint paths may share
+	MaxOverlap int             `json:"max_overlap,omitempty"`
+	Interfaces bool            `json:"interfaces,omitempty"`
+	Policies   []*PolicyConfig `json:"policies,omitempty"`
+}
+
+// Duration reads durations like "25ms" or "5m" from JSON
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return fmt.Errorf("duration must be a string like \"5m\", got %s", b)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// LoadConfig reads and validates a JSON configuration file
+func LoadConfig(filename string) (*Config, error) {
+	raw, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	var cfg Config
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: invalid configuration:\n%w", filename, err)
+	}
+	return &cfg, nil
+}
+
+// Validate reports all configuration errors at once
+func (cfg *Config) Validate() error {
+	var errs []error
+	if len(cfg.Servers) == 0 {
+		errs = append(errs, errors.New("no servers configured"))
+	}
+	for i, cc := range cfg.Certificates {
+		errs = append(errs, cc.validate(fmt.Sprintf("certificates[%d]", i))...)
+	}
+	ports := make(map[int]string)
+	usePort := func(at string, port int) {
+		if port < 1 || port > 65535 {
+			errs = append(errs, fmt.Errorf("%s: port %d out of range", at, port))
+		} else if other, ok := ports[port]; ok {
+			errs = append(errs, fmt.Errorf("%s: port %d already used by %s", at, port, other))
+		} else {
+			ports[port] = at
+		}
+	}
+	names := make(map[string]bool)
+	for i, sc := range cfg.Servers {
+		at := fmt.Sprintf("servers[%d]", i)
+		if sc.Name == "" {
+			errs = append(errs, fmt.Errorf("%s: missing name", at))
+		} else if names[sc.Name] {
+			errs = append(errs, fmt.Errorf("%s: duplicate name %q", at, sc.Name))
+		} else {
+			names[sc.Name] = true
+			at = fmt.Sprintf("servers[%d] %q", i, sc.Name)
+		}
+		switch sc.Type {
+		case "file", "content", "web":
+		default:
+			errs = append(errs, fmt.Errorf("%s: unknown server type %q, expected file, content or web", at, sc.Type))
+		}
+		switch sc.Protocol {
+		case "", ProtoSingleStream, ProtoHTTP3:
+		default:
+			errs = append(errs, fmt.Errorf("%s: unknown protocol %q, expected single-stream or http3", at, sc.Protocol))
+		}
+		usePort(at+".port", sc.Port)
+		if sc.Dir == "" {
+			errs = append(errs, fmt.Errorf("%s: missing dir", at))
+		} else if info, err := os.Stat(sc.Dir); err != nil || !info.IsDir() {
+			errs = append(errs, fmt.Errorf("%s: dir %q is not a directory", at, sc.Dir))
+		}
+		if sc.TLS != nil {
+			if sc.Type != "web" {
+				errs = append(errs, fmt.Errorf("%s.tls: only supported by web servers", at))
+			}
+			usePort(at+".tls.port", sc.TLS.Port)
+			if sc.TLS.Cert != "" || sc.TLS.Key != "" {
+				errs = append(errs, (&CertConfig{Cert: sc.TLS.Cert, Key: sc.TLS.Key}).validate(at+".tls")...)
+			} else if len(cfg.Certificates) == 0 {
+				errs = append(errs, fmt.Errorf("%s.tls: requires a certificate, set cert and key or certificates", at))
+			}
+		}
+		errs = append(errs, sc.Selector.validate(at+".selector")...)
+	}
+	return errors.Join(errs...)
+}
+
+func (cc *CertConfig) validate(at string) []error {
+	if cc.Cert == "" || cc.Key == "" {
+		return []error{fmt.Errorf("%s: cert and key are required", at)}
+	}
+	if _, err := tls.LoadX509KeyPair(cc.Cert, cc.Key); err != nil {
+		return []error{fmt.Errorf("%s: %w", at, err)}
+	}
+	return nil
+}
+
+func (sc *SelectorConfig) validate(at string) []error {
+	var errs []error
+	switch sc.Type {
+	case "default":
+	case "rr", "cb", "striping", "bandit":
+		if sc.Paths < 1 {
+			errs = append(errs, fmt.Errorf("%s: %s selector needs paths >= 1", at, sc.Type))
+		}
+	case "weighted":
+		errs = append(errs, sc.validateWeights(at)...)
+	case "selective":
+		if len(sc.PathIDs) == 0 {
+			errs = append(errs, fmt.Errorf("%s: selective selector needs path_ids", at))
+		}
+		for _, id := range sc.PathIDs {
+			if id < 0 {
+				errs = append(errs, fmt.Errorf("%s: negative path id %d", at, id))
+			}
+		}
+	case "range":
+		if len(sc.PathIDs) != 2 || sc.PathIDs[0] < 0 || sc.PathIDs[0] >= sc.PathIDs[1] {
+			errs = append(errs, fmt.Errorf("%s: range selector needs path_ids [start, end) with 0 <= start < end", at))
+		}
+	case "mux":
+		if csc, ok := sc.Classes[sc.Fallback]; !ok || csc == nil {
+			errs = append(errs, fmt.Errorf("%s: mux selector needs a selector for its fallback class %q", at, sc.Fallback))
+		}
+		for class, csc := range sc.Classes {
+			if csc == nil {
+				errs = append(errs, fmt.Errorf("%s.classes.%s: missing selector", at, class))
+				continue
+			}
+			if csc.Type == "mux" {
+				errs = append(errs, fmt.Errorf("%s.classes.%s: mux selectors cannot be nested", at, class))
+				continue
+			}
+			errs = append(errs, csc.validate(fmt.Sprintf("%s.classes.%s", at, class))...)
+		}
+	default:
+		errs = append(errs, fmt.Errorf("%s: unknown selector type %q, expected default, rr, cb, selective, range, striping, bandit, weighted or mux", at, sc.Type))
+	}
+	if sc.Type != "mux" && (len(sc.Classes) > 0 || len(sc.Routes) > 0) {
+		errs = append(errs, fmt.Errorf("%s: classes and routes are only supported by mux selectors", at))
+	}
+	if sc.Type != "weighted" && (len(sc.Weights) > 0 || sc.WeightBy != "") {
+		errs = append(errs, fmt.Errorf("%s: weights and weight_by are only supported by weighted selectors", at))
+	}
+	if sc.Iterations < 0 {
+		errs = append(errs, fmt.Errorf("%s: negative iterations", at))
+	}
+	if sc.MaxRemotes != nil && *sc.MaxRemotes < 0 {
+		errs = append(errs, fmt.Errorf("%s: negative max_remotes", at))
+	}
+	if sc.Policy != nil {
+		switch sc.Type {
+		case "cb", "selective", "range", "striping", "bandit", "weighted":
+		default:
+			errs = append(errs, fmt.Errorf("%s.policy: only supported by cb, selective, range, striping, bandit and weighted selectors", at))
+		}
+		errs = append(errs, sc.Policy.validate(at+".policy")...)
+	}
+	if (sc.Probe != nil || sc.Feedback) && (sc.Type == "default" || sc.Type == "mux") {
+		errs = append(errs, fmt.Errorf("%s: probe and feedback are not supported by %s selectors", at, sc.Type))
+	}
+	if sc.Probe != nil && (sc.Probe.Interval < 0 || sc.Probe.Timeout < 0) {
+		errs = append(errs, fmt.Errorf("%s.probe: negative interval or timeout", at))
+	}
+	return errs
+}
+
+// weighted selectors either weight the given path IDs explicitly or the best paths
+// explicitly or by weight_by
+func (sc *SelectorConfig) validateWeights(at string) []error {
+	var errs []error
+	if len(sc.PathIDs) > 0 {
+		if sc.WeightBy != "" {
+			errs = append(errs, fmt.Errorf("%s: weight_by is not supported with path_ids", at))
+		}
+		if len(sc.Weights) != len(sc.PathIDs) {
+			errs = append(errs, fmt.Errorf("%s: weighted selector needs one weight per path id", at))
+		}
+		seen := make(map[int]bool)
+		for _, id := range sc.PathIDs {
+			if id < 0 {
+				errs = append(errs, fmt.Errorf("%s: negative path id %d", at, id))
+			} else if seen[id] {
+				errs = append(errs, fmt.Errorf("%s: duplicate path id %d", at, id))
+			}
+			seen[id] = true
+		}
+	} else if sc.Paths < 1 {
+		errs = append(errs, fmt.Errorf("%s: weighted selector needs paths >= 1 or path_ids", at))
+	}
+	switch sc.WeightBy {
+	case "":
+		if err := validateWeights(sc.Weights); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", at, err))
+		}
+	case "inverse_latency", "bandwidth":
+		if len(sc.Weights) > 0 {
+			errs = append(errs, fmt.Errorf("%s: either weights or weight_by", at))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("%s: unknown weight_by %q, expected inverse_latency or bandwidth", at, sc.WeightBy))
+	}
+	return errs
+}
+
+// validateWeights checks explicit weights, also those set through the admin API
+func validateWeights(weights []float64) error {
+	positive := false
+	for _, w := range weights {
+		if w < 0 || math.IsNaN(w) || math.IsInf(w, 0) {
+			return fmt.Errorf("invalid weight %v", w)
+		}
+		positive = positive || w > 0
+	}
+	if !positive {
+		return errors.New("weights need at least one positive weight")
+	}
+	return nil
+}
+
+func (pc *PolicyConfig) validate(at string) []error {
+	var errs []error
+	switch pc.Type {
+	case "mtu", "bandwidth", "hops", "disjoint":
+	case "latency":
+		if pc.MaxLatency < 0 {
+			errs = append(errs, fmt.Errorf("%s: negative max_latency", at))
+		}
+	case "loss":
+		if pc.MaxLoss < 0 || pc.MaxLoss > 1 {
+			errs = append(errs, fmt.Errorf("%s: max_loss must be within [0, 1]", at))
+		}
+	case "and", "or", "then":
+		if len(pc.Policies) == 0 {
+			errs = append(errs, fmt.Errorf("%s: %s policy needs policies", at, pc.Type))
+		}
+		for i, sub := range pc.Policies {
+			if sub == nil {
+				errs = append(errs, fmt.Errorf("%s.policies[%d]: missing policy", at, i))
+				continue
+			}
+			errs = append(errs, sub.validate(fmt.Sprintf("%s.policies[%d]", at, i))...)
+		}
+	default:
+		errs = append(errs, fmt.Errorf("%s: unknown policy type %q, expected mtu, latency, loss, bandwidth, hops, disjoint, and, or or then", at, pc.Type))
+	}
+	if pc.MaxHops < 0 {
+		errs = append(errs, fmt.Errorf("%s: negative max_hops", at))
+	}
+	if pc.MaxOverlap < 0 {
+		errs = append(errs, fmt.Errorf("%s: negative max_overlap", at))
+	}
+	return errs
+}
+
+// tunableSelector is implemented by the selectors of selectors.go
+type tunableSelector interface {
+	SetRefreshInterval(interval time.Duration)
+	SetEviction(idleTimeout time.Duration, maxRemotes int)
+}
+
+// probedSelector is implemented by the selectors of selectors.go, see probe.go
+type probedSelector interface {
+	SetProber(pp *PathProber)
+}
+
+// build creates the reply selector of a validated configuration
+func (sc *SelectorConfig) build(src PathSource) (pan.ReplySelector, error) {
+	var pp *PathProber
+	var measured measurements
+	if sc.Feedback {
+		measured = append(measured, DefaultPathStats)
+	}
+	if sc.Probe != nil {
+		pp = NewPathProber(pingerFor(src), time.Duration(sc.Probe.Interval), time.Duration(sc.Probe.Timeout))
+		measured = append(measured, pp)
+	}
+	var rs pan.ReplySelector
+	switch sc.Type {
+	case "default":
+		return pan.NewDefaultReplySelector(), nil
+	case "rr":
+		rs = NewRRReplySelector(src, sc.Paths, sc.Iterations)
+	case "cb":
+		rs = NewCBReplySelector(src, sc.Policy.build(measured), sc.Paths, sc.Iterations)
+	case "selective":
+		rs = NewSelectivePathReplySelector(src, sc.Policy.build(measured), sc.PathIDs, sc.Iterations)
+	case "range":
+		rs = NewPathRangeReplySelector(src, sc.Policy.build(measured), sc.PathIDs, sc.Iterations)
+	case "striping":
+		rs = NewStripingReplySelector(src, sc.Policy.build(measured), sc.Paths, DefaultPathStats)
+	case "bandit":
+		rs = NewBanditReplySelector(src, sc.Policy.build(measured), sc.Paths, DefaultPathStats)
+	case "weighted":
+		if len(sc.PathIDs) > 0 {
+			rs = NewWeightedStrategicReplySelector(src, sc.Policy.build(measured), sc.PathIDs, sc.Weights)
+			break
+		}
+		var weigher PathWeigher = ExplicitWeights(sc.Weights)
+		switch sc.WeightBy {
+		case "inverse_latency":
+			weigher = InverseLatencyWeights{Measured: measured}
+		case "bandwidth":
+			weigher = BandwidthWeights{}
+		}
+		rs = NewWeightedReplySelector(src, sc.Policy.build(measured), sc.Paths, weigher)
+	case "mux":
+		selectors := make(map[ContentClass]pan.ReplySelector)
+		for class, csc := range sc.Classes {
+			if csc == nil {
+				continue
+			}
+			s, err := csc.build(src)
+			if err != nil {
+				return nil, fmt.Errorf("classes.%s: %w", class, err)
+			}
+			selectors[class] = s
+		}
+		mrs, err := NewMuxReplySelector(sc.Fallback, selectors)
+		if err != nil {
+			return nil, err
+		}
+		mrs.SetRoutes(sc.Routes)
+		return mrs, nil
+	}
+	if ts, ok := rs.(tunableSelector); ok {
+		if sc.RefreshInterval != nil {
+			ts.SetRefreshInterval(time.Duration(*sc.RefreshInterval))
+		}
+		if sc.IdleTimeout != nil || sc.MaxRemotes != nil {
+			idleTimeout, maxRemotes := defaultIdleTimeout, defaultMaxRemotes
+			if sc.IdleTimeout != nil {
+				idleTimeout = time.Duration(*sc.IdleTimeout)
+			}
+			if sc.MaxRemotes != nil {
+				maxRemotes = *sc.MaxRemotes
+			}
+			ts.SetEviction(idleTimeout, maxRemotes)
+		}
+	}
+	if ps, ok := rs.(probedSelector); ok && pp != nil {
+		ps.SetProber(pp)
+	}
+	return rs, nil
+}
+
+// build creates the path policy of a validated configuration, nil keeps all paths.
+// Latency and loss policies use the measurements if any.
+func (pc *PolicyConfig) build(measured measurements) PathPolicy {
+	if pc == nil {
+		return nil
+	}
+	var policies []PathPolicy
+	for _, sub := range pc.Policies {
+		policies = append(policies, sub.build(measured))
+	}
+	switch pc.Type {
+	case "mtu":
+		return MTUPolicy{Min: pc.MinMTU}
+	case "latency":
+		return LatencyPolicy{Max: time.Duration(pc.MaxLatency), Measured: measured}
+	case "loss":
+		return LossPolicy{Max: pc.MaxLoss, Measured: measured}
+	case "bandwidth":
+		return BandwidthPolicy{Min: pc.MinBandwidth}
+	case "hops":
+		return HopCountPolicy{Max: pc.MaxHops}
+	case "disjoint":
+		return DisjointPolicy{MaxOverlap: pc.MaxOverlap, Interfaces: pc.Interfaces}
+	case "and":
+		return And(policies...)
+	case "or":
+		return Or(policies...)
+	case "then":
+		return Then(policies...)
+	}
+	return nil
+}
+
+// startConfiguredServs starts every server of the configuration with its own reply selector,
+// a nil network serves on SCION
+func startConfiguredServs(sup *Supervisor, cfg *Config, network *simnet.Network) error {
+	certs := NewCertStore()
+	for _, cc := range cfg.Certificates {
+		if err := certs.Add(cc.Cert, cc.Key); err != nil {
+			return err
+		}
+	}
+	for _, sc := range cfg.Servers {
+		if sc.TLS != nil && sc.TLS.Cert != "" {
+			if err := certs.Add(sc.TLS.Cert, sc.TLS.Key); err != nil {
+				return err
+			}
+		}
+	}
+
+	var src PathSource = NewHostPathSource()
+	if network != nil {
+		src = NewSimPathSource(network)
+	}
+	reg := NewServerRegistry(src)
+	for i, sc := range cfg.Servers {
+		selector := sc.Selector
+		built, err := selector.build(src)
+		if err != nil {
+			return fmt.Errorf("servers[%d].selector: %w", i, err)
+		}
+		rs := reg.Register(sc.Name, ":"+strconv.Itoa(sc.Port), built, &selector)
+		dir := sc.Dir
+		port := strconv.Itoa(sc.Port)
+		proto := sc.Protocol
+		if proto == "" {
+			proto = ProtoSingleStream
+		}
+		switch sc.Type {
+		case "file":
+			file_server(sup, sc.Name, &dir, &port, certs, network, proto, sc.Routes, rs)
+		case "content":
+			content_server(sup, sc.Name, &dir, &port, certs, network, proto, sc.Routes, rs)
+		case "web":
+			var tlsPort string
+			if sc.TLS != nil {
+				tlsPort = strconv.Itoa(sc.TLS.Port)
+			}
+			web_server(sup, sc.Name, &dir, &tlsPort, &port, certs, network, proto, sc.Routes, rs)
+		}
+	}
+	if cfg.Admin != "" {
+		admin_server(sup, cfg.Admin, reg)
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testConfig returns a valid configuration of a web and a file server serving dir
+func testConfig(dir string) *Config {
+	return &Config{
+		Servers: []ServerConfig{
+			{
+				Name:     "web",
+				Type:     "web",
+				Port:     8080,
+				Dir:      dir,
+				Selector: SelectorConfig{Type: "default"},
+			},
+			{
+				Name: "files",
+				Type: "file",
+				Port: 8899,
+				Dir:  dir,
+				Selector: SelectorConfig{
+					Type:   "cb",
+					Paths:  5,
+					Policy: &PolicyConfig{Type: "then", Policies: []*PolicyConfig{{Type: "mtu", MinMTU: 1400}, {Type: "latency"}}},
+				},
+			},
+		},
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "index.html")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	maxRemotes := -1
+
+	tests := []struct {
+		name   string
+		modify func(cfg *Config)
+		// substrings of the expected errors, none for a valid configuration
+		errs []string
+	}{
+		{"valid", func(cfg *Config) {}, nil},
+		{"no servers", func(cfg *Config) { cfg.Servers = nil }, []string{"no servers configured"}},
+		{"missing name", func(cfg *Config) { cfg.Servers[0].Name = "" }, []string{`servers[0]: missing name`}},
+		{"duplicate name", func(cfg *Config) { cfg.Servers[1].Name = "web" }, []string{`servers[1]: duplicate name "web"`}},
+		{"unknown type", func(cfg *Config) { cfg.Servers[0].Type = "ftp" }, []string{`servers[0] "web": unknown server type "ftp"`}},
+		{"unknown protocol", func(cfg *Config) { cfg.Servers[0].Protocol = "tcp" }, []string{`unknown protocol "tcp"`}},
+		{"port out of range", func(cfg *Config) { cfg.Servers[0].Port = 70000 }, []string{`servers[0] "web".port: port 70000 out of range`}},
+		{"port used twice", func(cfg *Config) { cfg.Servers[1].Port = 8080 }, []string{`servers[1] "files".port: port 8080 already used by servers[0] "web".port`}},
+		{"dir is a file", func(cfg *Config) { cfg.Servers[0].Dir = file }, []string{"is not a directory"}},
+		{"missing dir", func(cfg *Config) { cfg.Servers[0].Dir = "" }, []string{`servers[0] "web": missing dir`}},
+		{
+			name:   "tls without certificate",
+			modify: func(cfg *Config) { cfg.Servers[0].TLS = &TLSConfig{Port: 8443} },
+			errs:   []string{`servers[0] "web".tls: requires a certificate`},
+		},
+		{
+			name:   "tls of a file server",
+			modify: func(cfg *Config) { cfg.Servers[1].TLS = &TLSConfig{Port: 8080} },
+			errs:   []string{`servers[1] "files".tls: only supported by web servers`, `port 8080 already used`, "requires a certificate"},
+		},
+		{
+			name:   "unknown selector",
+			modify: func(cfg *Config) { cfg.Servers[0].Selector.Type = "random" },
+			errs:   []string{`servers[0] "web".selector: unknown selector type "random"`},
+		},
+		{
+			name:   "selector without paths",
+			modify: func(cfg *Config) { cfg.Servers[1].Selector.Paths = 0 },
+			errs:   []string{`servers[1] "files".selector: cb selector needs paths >= 1`},
+		},
+		{
+			name: "policy of a default selector",
+			modify: func(cfg *Config) {
+				cfg.Servers[0].Selector.Policy = &PolicyConfig{Type: "mtu"}
+			},
+			errs: []string{`servers[0] "web".selector.policy: only supported by`},
+		},
+		{
+			name: "invalid nested policy",
+			modify: func(cfg *Config) {
+				cfg.Servers[1].Selector.Policy.Policies[1] = &PolicyConfig{Type: "latency", MaxLatency: Duration(-time.Second)}
+			},
+			errs: []string{`servers[1] "files".selector.policy.policies[1]: negative max_latency`},
+		},
+		{
+			name: "empty combined policy",
+			modify: func(cfg *Config) {
+				cfg.Servers[1].Selector.Policy = &PolicyConfig{Type: "or", Policies: []*PolicyConfig{nil}}
+			},
+			errs: []string{"policy.policies[0]: missing policy"},
+		},
+		{
+			name: "range",
+			modify: func(cfg *Config) {
+				cfg.Servers[1].Selector = SelectorConfig{Type: "range", PathIDs: []int{3, 3}}
+			},
+			errs: []string{"range selector needs path_ids [start, end)"},
+		},
+		{
+			name: "selective",
+			modify: func(cfg *Config) {
+				cfg.Servers[1].Selector = SelectorConfig{Type: "selective", PathIDs: []int{0, -1}}
+			},
+			errs: []string{"negative path id -1"},
+		},
+		{
+			name: "weights",
+			modify: func(cfg *Config) {
+				cfg.Servers[1].Selector = SelectorConfig{Type: "weighted", PathIDs: []int{0, 0}, Weights: []float64{1}}
+			},
+			errs: []string{"one weight per path id", "duplicate path id 0"},
+		},
+		{
+			name: "weights without a positive weight",
+			modify: func(cfg *Config) {
+				cfg.Servers[1].Selector = SelectorConfig{Type: "weighted", Paths: 2, Weights: []float64{0, 0}}
+			},
+			errs: []string{"weights need at least one positive weight"},
+		},
+		{
+			name: "weights and weight_by",
+			modify: func(cfg *Config) {
+				cfg.Servers[1].Selector = SelectorConfig{Type: "weighted", Paths: 2, Weights: []float64{1, 2}, WeightBy: "bandwidth"}
+			},
+			errs: []string{"either weights or weight_by"},
+		},
+		{
+			name: "weights of a cb selector",
+			modify: func(cfg *Config) {
+				cfg.Servers[1].Selector.Weights = []float64{1}
+			},
+			errs: []string{"weights and weight_by are only supported by weighted selectors"},
+		},
+		{
+			name: "negative tuning",
+			modify: func(cfg *Config) {
+				cfg.Servers[1].Selector.Iterations = -1
+				cfg.Servers[1].Selector.MaxRemotes = &maxRemotes
+				cfg.Servers[1].Selector.Probe = &ProbeConfig{Timeout: Duration(-time.Second)}
+			},
+			errs: []string{"negative iterations", "negative max_remotes", "probe: negative interval or timeout"},
+		},
+		{
+			name: "mux",
+			modify: func(cfg *Config) {
+				cfg.Servers[0].Selector = SelectorConfig{
+					Type:     "mux",
+					Fallback: ClassWeb,
+					Classes: map[ContentClass]*SelectorConfig{
+						ClassWeb:    {Type: "default"},
+						ClassStream: {Type: "rr"},
+					},
+					Routes: map[string]ContentClass{"/video/": ClassStream},
+				}
+			},
+			errs: []string{`servers[0] "web".selector.classes.stream: rr selector needs paths >= 1`},
+		},
+		{
+			name: "mux without fallback",
+			modify: func(cfg *Config) {
+				cfg.Servers[0].Selector = SelectorConfig{
+					Type:     "mux",
+					Fallback: ClassContent,
+					Classes:  map[ContentClass]*SelectorConfig{ClassWeb: {Type: "default"}, ClassContent: nil},
+				}
+			},
+			errs: []string{`needs a selector for its fallback class "content"`, "classes.content: missing selector"},
+		},
+		{
+			name: "nested mux",
+			modify: func(cfg *Config) {
+				cfg.Servers[0].Selector = SelectorConfig{
+					Type:     "mux",
+					Fallback: ClassWeb,
+					Classes:  map[ContentClass]*SelectorConfig{ClassWeb: {Type: "mux"}},
+				}
+			},
+			errs: []string{"classes.web: mux selectors cannot be nested"},
+		},
+		{
+			name: "classes of a cb selector",
+			modify: func(cfg *Config) {
+				cfg.Servers[1].Selector.Routes = map[string]ContentClass{"/": ClassWeb}
+			},
+			errs: []string{"classes and routes are only supported by mux selectors"},
+		},
+		{
+			name: "several errors at once",
+			modify: func(cfg *Config) {
+				cfg.Servers[0].Type = ""
+				cfg.Servers[1].Port = 0
+			},
+			errs: []string{`servers[0] "web": unknown server type ""`, `servers[1] "files".port: port 0 out of range`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(dir)
+			tt.modify(cfg)
+			err := cfg.Validate()
+			if len(tt.errs) == 0 {
+				if err != nil {
+					t.Fatalf("valid configuration rejected: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("invalid configuration accepted, expected %q", tt.errs)
+			}
+			for _, e := range tt.errs {
+				if !strings.Contains(err.Error(), e) {
+					t.Errorf("error %q does not report %q", err, e)
+				}
+			}
+			// every error is reported on its own line
+			var joined interface{ Unwrap() []error }
+			if !errors.As(err, &joined) || len(joined.Unwrap()) != len(tt.errs) {
+				t.Errorf("error %q, expected %d errors", err, len(tt.errs))
+			}
+		})
+	}
+}
+
+func TestDurationJSON(t *testing.T) {
+	var d Duration
+	if err := d.UnmarshalJSON([]byte(`"25ms"`)); err != nil || time.Duration(d) != 25*time.Millisecond {
+		t.Errorf("got %v, %v, expected 25ms", time.Duration(d), err)
+	}
+	if err := d.UnmarshalJSON([]byte(`25`)); err == nil {
+		t.Error("duration without unit accepted")
+	}
+	if b, err := Duration(5 * time.Minute).MarshalJSON(); err != nil || string(b) != `"5m0s"` {
+		t.Errorf("got %s, %v, expected \"5m0s\"", b, err)
+	}
+}
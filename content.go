@@ -0,0 +1,390 @@
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+// ContentClass categorizes the replies of a request for the reply path selection
+type ContentClass string
+
+const (
+	// pages, text, json and other small general web content
+	ClassWeb ContentClass = "web"
+	// images, gifs, audio and other static content distribution
+	ClassContent ContentClass = "content"
+	// video, HLS playlists and segments and other large objects
+	ClassStream ContentClass = "stream"
+)
+
+// default size in bytes from which a reply counts as ClassStream
+const defaultStreamSize = 8 << 20
+
+// streaming file extensions missing in or misnamed by common MIME tables
+var streamExtensions = map[string]struct{}{
+	".m3u8": {},
+	".ts":   {},
+	".m4s":  {},
+	".mp4":  {},
+	".webm": {},
+}
+
+// ContentClassifier classifies requests by route, MIME type and reply size
+type ContentClassifier struct {
+	// Routes maps URL path prefixes to classes, the longest matching prefix wins
+	// and takes precedence over MIME type and size
+	Routes map[string]ContentClass
+	// replies or requested ranges of at least StreamSize bytes are ClassStream
+	StreamSize int64
+}
+
+func NewContentClassifier(routes map[string]ContentClass) *ContentClassifier {
+	return &ContentClassifier{
+		Routes:     routes,
+		StreamSize: defaultStreamSize,
+	}
+}
+
+// fixed reports whether the class of a request is decided by its route or file extension
+func (cc *ContentClassifier) fixed(r *http.Request) bool {
+	_, ok := cc.route(r.URL.Path)
+	return ok || isStreamFile(r.URL.Path)
+}
+
+func isStreamFile(urlPath string) bool {
+	_, ok := streamExtensions[strings.ToLower(path.Ext(urlPath))]
+	return ok
+}
+
+// route returns the class of the longest route prefix matching the request path
+func (cc *ContentClassifier) route(urlPath string) (ContentClass, bool) {
+	var class ContentClass
+	matched := -1
+	for prefix, c := range cc.Routes {
+		if strings.HasPrefix(urlPath, prefix) && len(prefix) > matched {
+			class, matched = c, len(prefix)
+		}
+	}
+	return class, matched >= 0
+}
+
+// Classify returns the class of a request before it is handled, based on its route,
+// the MIME type of the requested file extension and the size of a requested range
+func (cc *ContentClassifier) Classify(r *http.Request) ContentClass {
+	if class, ok := cc.route(r.URL.Path); ok {
+		return class
+	}
+	if isStreamFile(r.URL.Path) {
+		return ClassStream
+	}
+	if size, ok := rangeSize(r.Header.Get("Range")); ok && cc.StreamSize > 0 && size >= cc.StreamSize {
+		return ClassStream
+	}
+	return classifyMIME(mime.TypeByExtension(path.Ext(r.URL.Path)))
+}
+
+// ClassifyReply refines the class of a request once the reply headers are known.
+// For partial content Content-Length is the size of the served range.
+func (cc *ContentClassifier) ClassifyReply(r *http.Request, header http.Header, class ContentClass) ContentClass {
+	if cc.fixed(r) {
+		return class
+	}
+	if size, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64); err == nil && cc.StreamSize > 0 && size >= cc.StreamSize {
+		return ClassStream
+	}
+	if contentType := header.Get("Content-Type"); contentType != "" {
+		return classifyMIME(contentType)
+	}
+	return class
+}
+
+func classifyMIME(contentType string) ContentClass {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case strings.HasPrefix(mediaType, "video/"),
+		mediaType == "application/vnd.apple.mpegurl",
+		mediaType == "application/x-mpegurl":
+		return ClassStream
+	case strings.HasPrefix(mediaType, "image/"),
+		strings.HasPrefix(mediaType, "audio/"),
+		mediaType == "application/octet-stream":
+		return ClassContent
+	default:
+		return ClassWeb
+	}
+}
+
+// rangeSize returns the number of bytes of a single closed "bytes=a-b" range
+func rangeSize(header string) (int64, bool) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return 0, false
+	}
+	first, last, ok := strings.Cut(spec, "-")
+	if !ok {
+		return 0, false
+	}
+	start, err := strconv.ParseInt(strings.TrimSpace(first), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	end, err := strconv.ParseInt(strings.TrimSpace(last), 10, 64)
+	if err != nil || end < start {
+		return 0, false
+	}
+	return end - start + 1, true
+}
+
+// MuxReplySelector delegates the reply path selection of every remote to the
+// selector of the content class the remote currently requests. Only that selector
+// records the remote, the selector of another class records it with the last
+// recorded path once the remote switches to the class.
+type MuxReplySelector struct {
+	mtx       sync.RWMutex
+	selectors map[ContentClass]pan.ReplySelector
+	fallback  ContentClass
+	classes   map[pan.UDPAddr]*classEntry
+	// remotes ordered from most to least recently classified, evicted like in evict.go
+	lru *list.List
+	// routes complement the routes of the server using the selector
+	routes map[string]ContentClass
+	// classifiers of the servers using the selector merged with routes
+	classifiers map[*ContentClassifier]*ContentClassifier
+	name        string
+}
+
+type classEntry struct {
+	class ContentClass
+	seen  time.Time
+	lru   *list.Element
+	// path of the last recorded packet and the classes whose selector recorded the remote
+	path     *pan.Path
+	recorded map[ContentClass]bool
+}
+
+// NewMuxReplySelector requires a selector for the fallback class, which is used
+// for remotes without a class and classes without a selector
+func NewMuxReplySelector(fallback ContentClass, selectors map[ContentClass]pan.ReplySelector) (*MuxReplySelector, error) {
+	if s, ok := selectors[fallback]; !ok || s == nil {
+		return nil, fmt.Errorf("no reply selector for fallback content class %q", fallback)
+	}
+	mrs := &MuxReplySelector{
+		selectors: selectors,
+		fallback:  fallback,
+		classes:   make(map[pan.UDPAddr]*classEntry),
+		lru:       list.New(),
+	}
+	mrs.SetName("mux")
+	return mrs, nil
+}
+
+// SetRoutes sets content class routes overriding those of the server.
+// Has to be set before the selector is used by a server.
+func (mrs *MuxReplySelector) SetRoutes(routes map[string]ContentClass) {
+	mrs.routes = routes
+}
+
+// classifier returns the classifier of a server extended by the routes of the selector,
+// it is merged once per server
+func (mrs *MuxReplySelector) classifier(cc *ContentClassifier) *ContentClassifier {
+	if len(mrs.routes) == 0 {
+		return cc
+	}
+	mrs.mtx.Lock()
+	defer mrs.mtx.Unlock()
+	if merged, ok := mrs.classifiers[cc]; ok {
+		return merged
+	}
+	merged := &ContentClassifier{Routes: make(map[string]ContentClass), StreamSize: cc.StreamSize}
+	for route, class := range cc.Routes {
+		merged.Routes[route] = class
+	}
+	for route, class := range mrs.routes {
+		merged.Routes[route] = class
+	}
+	if mrs.classifiers == nil {
+		mrs.classifiers = make(map[*ContentClassifier]*ContentClassifier)
+	}
+	mrs.classifiers[cc] = merged
+	return merged
+}
+
+// SetClass selects the content class for the next replies to remote. Remotes not
+// classified within defaultIdleTimeout and the least recently classified remotes
+// beyond defaultMaxRemotes are forgotten and replied to by the fallback selector.
+func (mrs *MuxReplySelector) SetClass(remote pan.UDPAddr, class ContentClass) {
+	mrs.mtx.Lock()
+	e := mrs.entry(remote)
+	e.class = class
+	e.seen = time.Now()
+	mrs.lru.MoveToFront(e.lru)
+	mrs.evict(e.seen)
+	mrs.mtx.Unlock()
+	mrs.recordLazily(remote, mrs.selectorClass(class))
+}
+
+// entry returns the entry of remote, a new remote has the fallback class.
+// The caller must hold mtx.
+func (mrs *MuxReplySelector) entry(remote pan.UDPAddr) *classEntry {
+	e, ok := mrs.classes[remote]
+	if !ok {
+		e = &classEntry{class: mrs.fallback, seen: time.Now(), lru: mrs.lru.PushFront(remote), recorded: make(map[ContentClass]bool)}
+		mrs.classes[remote] = e
+	}
+	return e
+}
+
+// evict forgets the remotes beyond the limits, the caller must hold mtx
+func (mrs *MuxReplySelector) evict(now time.Time) {
+	for elem := mrs.lru.Back(); elem != nil; elem = mrs.lru.Back() {
+		r := elem.Value.(pan.UDPAddr)
+		if len(mrs.classes) <= defaultMaxRemotes && now.Sub(mrs.classes[r].seen) < defaultIdleTimeout {
+			break
+		}
+		mrs.lru.Remove(elem)
+		delete(mrs.classes, r)
+	}
+}
+
+// selectorClass returns the class whose selector replies for class
+func (mrs *MuxReplySelector) selectorClass(class ContentClass) ContentClass {
+	if _, ok := mrs.selectors[class]; ok {
+		return class
+	}
+	return mrs.fallback
+}
+
+// classOf returns the class whose selector replies to remote
+func (mrs *MuxReplySelector) classOf(remote pan.UDPAddr) ContentClass {
+	mrs.mtx.RLock()
+	defer mrs.mtx.RUnlock()
+	if e, ok := mrs.classes[remote]; ok {
+		return mrs.selectorClass(e.class)
+	}
+	return mrs.fallback
+}
+
+// recordLazily records remote in the selector of class with the path of its last
+// recorded packet, unless the selector already recorded the remote. Selectors may
+// query paths while recording, so they are called without holding mtx.
+func (mrs *MuxReplySelector) recordLazily(remote pan.UDPAddr, class ContentClass) {
+	mrs.mtx.Lock()
+	e, ok := mrs.classes[remote]
+	if !ok || len(e.recorded) == 0 || e.recorded[class] {
+		mrs.mtx.Unlock()
+		return
+	}
+	e.recorded[class] = true
+	path := e.path
+	mrs.mtx.Unlock()
+	mrs.selectors[class].Record(remote, path)
+}
+
+// Path falls back to the fallback selector if the class selector has no path,
+// e.g. because its policy filtered out every path to the remote
+func (mrs *MuxReplySelector) Path(remote pan.UDPAddr) *pan.Path {
+	if p := mrs.selectors[mrs.classOf(remote)].Path(remote); p != nil {
+		return p
+	}
+	mrs.recordLazily(remote, mrs.fallback)
+	return mrs.selectors[mrs.fallback].Path(remote)
+}
+
+func (mrs *MuxReplySelector) Initialize(local pan.UDPAddr) {
+	for _, s := range mrs.selectors {
+		s.Initialize(local)
+	}
+}
+
+// Record records remote only in the selector of its current class
+func (mrs *MuxReplySelector) Record(remote pan.UDPAddr, path *pan.Path) {
+	mrs.mtx.Lock()
+	e := mrs.entry(remote)
+	e.path = path
+	class := mrs.selectorClass(e.class)
+	e.recorded[class] = true
+	mrs.evict(time.Now())
+	mrs.mtx.Unlock()
+	mrs.selectors[class].Record(remote, path)
+}
+
+func (mrs *MuxReplySelector) PathDown(pf pan.PathFingerprint, pi pan.PathInterface) {
+	for _, s := range mrs.selectors {
+		s.PathDown(pf, pi)
+	}
+}
+
+func (mrs *MuxReplySelector) Close() error {
+	var firstErr error
+	for _, s := range mrs.selectors {
+		if err := s.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// ContentSelection is a middleware telling the mux selector the content class of
+// every request before its reply is written. Requests on one connection share the
+// remote address, so concurrent requests on it use the class of the latest one.
+func ContentSelection(mrs *MuxReplySelector, cc *ContentClassifier, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remote, err := pan.ParseUDPAddr(r.RemoteAddr)
+		if err != nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		class := cc.Classify(r)
+		mrs.SetClass(remote, class)
+		h.ServeHTTP(&classifyingWriter{
+			ResponseWriter: w,
+			request:        r,
+			remote:         remote,
+			class:          class,
+			cc:             cc,
+			mrs:            mrs,
+		}, r)
+	})
+}
+
+// classifyingWriter refines the class from the reply headers before the body is sent
+type classifyingWriter struct {
+	http.ResponseWriter
+	request     *http.Request
+	remote      pan.UDPAddr
+	class       ContentClass
+	cc          *ContentClassifier
+	mrs         *MuxReplySelector
+	wroteHeader bool
+}
+
+func (cw *classifyingWriter) WriteHeader(status int) {
+	if !cw.wroteHeader {
+		cw.wroteHeader = true
+		if class := cw.cc.ClassifyReply(cw.request, cw.Header(), cw.class); class != cw.class {
+			cw.class = class
+			cw.mrs.SetClass(cw.remote, class)
+		}
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *classifyingWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+func (cw *classifyingWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+func TestClassify(t *testing.T) {
+	cc := NewContentClassifier(map[string]ContentClass{
+		"/media/":      ClassContent,
+		"/media/live/": ClassStream,
+		"/api":         ClassWeb,
+	})
+	cc.StreamSize = 1000
+
+	tests := []struct {
+		name     string
+		path     string
+		rangeHdr string
+		expected ContentClass
+	}{
+		{"route prefix", "/media/a.html", "", ClassContent},
+		{"longest route prefix", "/media/live/a.html", "", ClassStream},
+		{"route before extension", "/api/playlist.m3u8", "", ClassWeb},
+		{"route before range", "/api/a.html", "bytes=0-5000", ClassWeb},
+		{"stream extension", "/v/playlist.m3u8", "", ClassStream},
+		{"stream extension ignores case", "/v/SEGMENT.TS", "", ClassStream},
+		{"stream range", "/a.html", "bytes=0-999", ClassStream},
+		{"small range", "/a.html", "bytes=0-998", ClassWeb},
+		{"image", "/a.png", "", ClassContent},
+		{"html", "/index.html", "", ClassWeb},
+		{"unknown extension", "/a.unknown", "", ClassWeb},
+		{"no extension", "/", "", ClassWeb},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.rangeHdr != "" {
+				r.Header.Set("Range", tt.rangeHdr)
+			}
+			if class := cc.Classify(r); class != tt.expected {
+				t.Errorf("classified as %s, expected %s", class, tt.expected)
+			}
+		})
+	}
+}
+
+func TestClassifyReply(t *testing.T) {
+	cc := NewContentClassifier(map[string]ContentClass{"/static/": ClassContent})
+	cc.StreamSize = 1000
+
+	tests := []struct {
+		name          string
+		path          string
+		contentType   string
+		contentLength string
+		class         ContentClass
+		expected      ContentClass
+	}{
+		{"large reply", "/a", "text/html", "1000", ClassWeb, ClassStream},
+		{"small reply", "/a", "text/html", "999", ClassContent, ClassWeb},
+		{"video", "/a", "video/mp4", "", ClassWeb, ClassStream},
+		{"hls playlist", "/a", "application/vnd.apple.mpegurl", "", ClassWeb, ClassStream},
+		{"image with parameters", "/a", "image/png; q=1", "", ClassWeb, ClassContent},
+		{"audio", "/a", "audio/ogg", "", ClassWeb, ClassContent},
+		{"octet stream", "/a", "application/octet-stream", "", ClassWeb, ClassContent},
+		{"json", "/a", "application/json", "", ClassContent, ClassWeb},
+		{"malformed length", "/a", "", "many", ClassContent, ClassContent},
+		{"no headers", "/a", "", "", ClassContent, ClassContent},
+		{"route is kept", "/static/a", "video/mp4", "5000", ClassContent, ClassContent},
+		{"stream extension is kept", "/a.ts", "text/html", "", ClassStream, ClassStream},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			header := make(http.Header)
+			if tt.contentType != "" {
+				header.Set("Content-Type", tt.contentType)
+			}
+			if tt.contentLength != "" {
+				header.Set("Content-Length", tt.contentLength)
+			}
+			if class := cc.ClassifyReply(r, header, tt.class); class != tt.expected {
+				t.Errorf("classified as %s, expected %s", class, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRangeSize(t *testing.T) {
+	tests := []struct {
+		header string
+		size   int64
+		ok     bool
+	}{
+		{"bytes=0-0", 1, true},
+		{"bytes=0-1023", 1024, true},
+		{"bytes= 100 - 199", 100, true},
+		{"", 0, false},
+		{"bytes=100-", 0, false},
+		{"bytes=-100", 0, false},
+		{"bytes=200-100", 0, false},
+		{"bytes=0-10,20-30", 0, false},
+		{"bytes=a-b", 0, false},
+		{"bytes=100", 0, false},
+		{"items=0-10", 0, false},
+	}
+	for _, tt := range tests {
+		size, ok := rangeSize(tt.header)
+		if size != tt.size || ok != tt.ok {
+			t.Errorf("range %q is %d, %t, expected %d, %t", tt.header, size, ok, tt.size, tt.ok)
+		}
+	}
+}
+
+func TestContentSelection(t *testing.T) {
+	mps := NewMemoryPathSource()
+	mps.SetPaths(testRemoteIA, []*pan.Path{testPath(1, 2)})
+	if _, err := NewMuxReplySelector(ClassWeb, map[ContentClass]pan.ReplySelector{ClassStream: NewRRReplySelector(mps, 5, 0)}); err == nil {
+		t.Error("mux selector without fallback selector accepted")
+	}
+	mrs, err := NewMuxReplySelector(ClassWeb, map[ContentClass]pan.ReplySelector{
+		ClassWeb:    NewRRReplySelector(mps, 5, 0),
+		ClassStream: NewRRReplySelector(mps, 5, 0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc := NewContentClassifier(nil)
+	cc.StreamSize = 1000
+	remote := pan.UDPAddr{IA: testRemoteIA, IP: netip.MustParseAddr("127.0.0.1"), Port: 1}
+
+	tests := []struct {
+		name     string
+		path     string
+		length   string
+		expected ContentClass
+	}{
+		{"by request", "/index.m3u8", "", ClassStream},
+		{"by reply length", "/index.html", "5000", ClassStream},
+		{"small reply", "/index.html", "10", ClassWeb},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var served ContentClass
+			h := ContentSelection(mrs, cc, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				served = mrs.classes[remote].class
+				if tt.length != "" {
+					w.Header().Set("Content-Length", tt.length)
+				}
+				w.Write([]byte("reply"))
+			}))
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			r.RemoteAddr = remote.String()
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			if served != cc.Classify(r) {
+				t.Errorf("handled as %s, expected the request class %s", served, cc.Classify(r))
+			}
+			if class := mrs.classes[remote].class; class != tt.expected {
+				t.Errorf("replied as %s, expected %s", class, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMuxRecord(t *testing.T) {
+	a := testPath(1, 2)
+	known, unknown := testRemote(1), testRemote(2)
+	web := newFakeSelector(map[pan.UDPAddr]*pan.Path{known: a, unknown: a})
+	stream := newFakeSelector(map[pan.UDPAddr]*pan.Path{known: a})
+	mrs, err := NewMuxReplySelector(ClassWeb, map[ContentClass]pan.ReplySelector{ClassWeb: web, ClassStream: stream})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectRecorded := func(name string, fs *fakeSelector, expected ...pan.UDPAddr) {
+		t.Helper()
+		fs.mtx.Lock()
+		defer fs.mtx.Unlock()
+		if len(fs.recorded) != len(expected) {
+			t.Fatalf("%s selector recorded %v, expected %v", name, fs.recorded, expected)
+		}
+		for i := range expected {
+			if fs.recorded[i] != expected[i] {
+				t.Fatalf("%s selector recorded %v, expected %v", name, fs.recorded, expected)
+			}
+		}
+	}
+
+	// remotes without a class are recorded by the fallback selector only
+	mrs.Record(known, a)
+	expectRecorded("web", web, known)
+	expectRecorded("stream", stream)
+
+	// switching the class records the remote in the selector of the class once
+	mrs.SetClass(known, ClassStream)
+	expectRecorded("stream", stream, known)
+	mrs.Record(known, a)
+	mrs.SetClass(known, ClassStream)
+	expectRecorded("stream", stream, known, known)
+	expectRecorded("web", web, known)
+	mrs.SetClass(known, ClassWeb)
+	mrs.SetClass(known, ClassContent)
+	expectRecorded("web", web, known)
+
+	// a remote classified before its first packet is recorded with its first packet
+	mrs.SetClass(unknown, ClassStream)
+	expectRecorded("stream", stream, known, known)
+	mrs.Record(unknown, a)
+	expectRecorded("stream", stream, known, known, unknown)
+	// the fallback selector records the remote once the class selector has no path to it
+	if p := mrs.Path(unknown); p != a {
+		t.Errorf("replied over %v, expected the path of the fallback selector", p)
+	}
+	expectRecorded("web", web, known, unknown)
+	mrs.Path(unknown)
+	expectRecorded("web", web, known, unknown)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"container/list"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+const (
+	// remotes that have not been seen for this long are forgotten
+	defaultIdleTimeout = 10 * time.Minute
+	// at most this many remotes are recorded, the least recently seen is dropped first
+	defaultMaxRemotes = 10000
+)
+
+// SetEviction configures when recorded remotes are forgotten.
+// Zero disables the idle timeout or the limit on the number of remotes respectively.
+// Has to be set before the selector is initialized.
+func (rrrs *RRReplySelector) SetEviction(idleTimeout time.Duration, maxRemotes int) {
+	rrrs.idleTimeout = idleTimeout
+	rrrs.maxRemotes = maxRemotes
+}
+
+func (cbrs *CBReplySelector) SetEviction(idleTimeout time.Duration, maxRemotes int) {
+	cbrs.rrrs.SetEviction(idleTimeout, maxRemotes)
+}
+
+func (srs *StrategicReplySelector) SetEviction(idleTimeout time.Duration, maxRemotes int) {
+	srs.cbrs.rrrs.SetEviction(idleTimeout, maxRemotes)
+}
+
+// RemoteCount returns the number of currently recorded remotes
+func (rrrs *RRReplySelector) RemoteCount() int {
+	rrrs.mtx.RLock()
+	defer rrrs.mtx.RUnlock()
+	return len(rrrs.remotes)
+}
+
+func (cbrs *CBReplySelector) RemoteCount() int {
+	return cbrs.rrrs.RemoteCount()
+}
+
+func (srs *StrategicReplySelector) RemoteCount() int {
+	return srs.cbrs.rrrs.RemoteCount()
+}
+
+// touch marks the remote as most recently seen, the caller must hold mtx
+func (rrrs *RRReplySelector) touch(r *remoteEntry, now time.Time) {
+	r.Seen = now
+	rrrs.lru.MoveToFront(r.lru)
+}
+
+// insertRemote records a new remote and drops the least recently seen remotes
+// beyond maxRemotes, the caller must hold mtx
+func (rrrs *RRReplySelector) insertRemote(remote pan.UDPAddr, r *remoteEntry) {
+	rrrs.remotes[remote] = r
+	r.lru = rrrs.lru.PushFront(remote)
+	for rrrs.maxRemotes > 0 && len(rrrs.remotes) > rrrs.maxRemotes {
+		rrrs.removeRemote(rrrs.lru.Back())
+	}
+}
+
+func (rrrs *RRReplySelector) removeRemote(elem *list.Element) {
+	remote := rrrs.lru.Remove(elem).(pan.UDPAddr)
+	delete(rrrs.remotes, remote)
+	if rrrs.prober != nil {
+		rrrs.prober.Untrack(remote)
+	}
+}
+
+// evictIdle forgets all remotes that have not been seen within idleTimeout
+func (rrrs *RRReplySelector) evictIdle(now time.Time) {
+	if rrrs.idleTimeout <= 0 {
+		return
+	}
+	rrrs.mtx.Lock()
+	defer rrrs.mtx.Unlock()
+	for elem := rrrs.lru.Back(); elem != nil; elem = rrrs.lru.Back() {
+		remote := elem.Value.(pan.UDPAddr)
+		if now.Sub(rrrs.remotes[remote].Seen) < rrrs.idleTimeout {
+			return
+		}
+		rrrs.removeRemote(elem)
+	}
+}
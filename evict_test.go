@@ -0,0 +1,108 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+// recordedPorts returns the ports of the recorded remotes from most to least recently seen
+func recordedPorts(rrrs *RRReplySelector) []uint16 {
+	rrrs.mtx.RLock()
+	defer rrrs.mtx.RUnlock()
+	var ports []uint16
+	for elem := rrrs.lru.Front(); elem != nil; elem = elem.Next() {
+		ports = append(ports, elem.Value.(pan.UDPAddr).Port)
+	}
+	return ports
+}
+
+func expectPorts(t *testing.T, ports, expected []uint16) {
+	t.Helper()
+	if len(ports) != len(expected) {
+		t.Fatalf("remotes %v recorded, expected %v", ports, expected)
+	}
+	for i := range ports {
+		if ports[i] != expected[i] {
+			t.Fatalf("remotes %v recorded, expected %v", ports, expected)
+		}
+	}
+}
+
+func TestEvictMaxRemotes(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxRemotes int
+		// ports of the recorded remotes in their order
+		records  []uint16
+		expected []uint16
+	}{
+		{"below the limit", 3, []uint16{1, 2, 3}, []uint16{3, 2, 1}},
+		{"least recently seen first", 2, []uint16{1, 2, 3, 4}, []uint16{4, 3}},
+		{"seen again", 2, []uint16{1, 2, 1, 3}, []uint16{3, 1}},
+		{"evicted and recorded again", 2, []uint16{1, 2, 3, 1}, []uint16{1, 3}},
+		{"no limit", 0, []uint16{1, 2, 3, 4, 5}, []uint16{5, 4, 3, 2, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mps := NewMemoryPathSource()
+			mps.SetPaths(testRemoteIA, []*pan.Path{testPath(1, 2)})
+			rrrs := NewRRReplySelector(mps, 5, 0)
+			rrrs.SetEviction(0, tt.maxRemotes)
+
+			for _, port := range tt.records {
+				rrrs.Record(testRemote(port), testPath(1, 2))
+			}
+			expectPorts(t, recordedPorts(rrrs), tt.expected)
+			for _, port := range tt.expected {
+				if rrrs.Path(testRemote(port)) == nil {
+					t.Errorf("no reply path to recorded remote %d", port)
+				}
+			}
+		})
+	}
+}
+
+func TestEvictIdle(t *testing.T) {
+	mps := NewMemoryPathSource()
+	mps.SetPaths(testRemoteIA, []*pan.Path{testPath(1, 2)})
+	rrrs := NewRRReplySelector(mps, 5, 0)
+	rrrs.SetEviction(time.Minute, 0)
+	pp := NewPathProber(mps, time.Minute, time.Second)
+	rrrs.SetProber(pp)
+
+	for _, port := range []uint16{1, 2, 3} {
+		rrrs.Record(testRemote(port), testPath(1, 2))
+	}
+	// remote 1 is seen again, remote 2 is left idle the longest
+	rrrs.Record(testRemote(1), testPath(1, 2))
+	now := time.Now()
+
+	rrrs.evictIdle(now)
+	expectPorts(t, recordedPorts(rrrs), []uint16{1, 3, 2})
+
+	rrrs.mtx.Lock()
+	rrrs.remotes[testRemote(2)].Seen = now.Add(-time.Minute)
+	rrrs.mtx.Unlock()
+	rrrs.evictIdle(now)
+	expectPorts(t, recordedPorts(rrrs), []uint16{1, 3})
+	if rrrs.Path(testRemote(2)) != nil {
+		t.Error("reply path to an evicted remote")
+	}
+	pp.mtx.RLock()
+	_, tracked := pp.targets[testRemote(2)]
+	pp.mtx.RUnlock()
+	if tracked {
+		t.Error("evicted remote is still probed")
+	}
+
+	rrrs.evictIdle(now.Add(time.Minute))
+	expectPorts(t, recordedPorts(rrrs), nil)
+
+	// without idle timeout remotes are kept
+	rrrs.SetEviction(0, 0)
+	rrrs.Record(testRemote(1), testPath(1, 2))
+	rrrs.evictIdle(now.Add(time.Hour))
+	expectPorts(t, recordedPorts(rrrs), []uint16{1})
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/logging"
+)
+
+const (
+	// weight of a new RTT sample in the smoothed RTT of a path, as in RFC 9002
+	feedbackRTTWeight = 0.125
+	// weight of a delivered or lost packet in the loss rate of a path
+	feedbackLossWeight = 1.0 / 64
+	// observations older than this are not used to rate a path
+	pathStatsTimeout = 2 * time.Minute
+	// a sent packet that has not been written within this time is not bound to a path
+	feedbackBindTimeout = 1 * time.Second
+	// a written packet is matched with one of this many oldest sent packets
+	feedbackBindLookahead = 8
+)
+
+// DefaultPathStats collects the observations of all listeners without a PathStats of their own
+var DefaultPathStats = NewPathStats()
+
+// PathStats collects the performance the QUIC connections of the servers observe per
+// reply path, without any probe traffic. Selectors prefer well performing paths by
+// using it as the measured latencies of their latency policy or with a LossPolicy.
+type PathStats struct {
+	mtx   sync.RWMutex
+	paths map[pan.PathFingerprint]*PathPerformance
+}
+
+// PathPerformance is the performance observed on a path
+type PathPerformance struct {
+	// smoothed RTT, zero as long as no packet over the path was acknowledged
+	RTT time.Duration
+	// smoothed share of lost packets
+	Loss float64
+	// acknowledged bytes and lost packets in total
+	Delivered uint64
+	Lost      uint64
+	Updated   time.Time
+}
+
+func NewPathStats() *PathStats {
+	return &PathStats{paths: make(map[pan.PathFingerprint]*PathPerformance)}
+}
+
+// record returns the performance record of the path, the caller must hold mtx
+func (ps *PathStats) record(pf pan.PathFingerprint) *PathPerformance {
+	p, ok := ps.paths[pf]
+	if !ok {
+		p = &PathPerformance{}
+		ps.paths[pf] = p
+	}
+	p.Updated = time.Now()
+	return p
+}
+
+// ObserveRTT feeds an RTT sample of a packet sent over the path
+func (ps *PathStats) ObserveRTT(pf pan.PathFingerprint, rtt time.Duration) {
+	ps.mtx.Lock()
+	defer ps.mtx.Unlock()
+	p := ps.record(pf)
+	if p.RTT == 0 {
+		p.RTT = rtt
+	} else {
+		p.RTT += time.Duration(feedbackRTTWeight * float64(rtt-p.RTT))
+	}
+}
+
+// ObserveDelivered feeds an acknowledged packet of size bytes sent over the path
+func (ps *PathStats) ObserveDelivered(pf pan.PathFingerprint, size uint64) {
+	ps.mtx.Lock()
+	defer ps.mtx.Unlock()
+	p := ps.record(pf)
+	p.Delivered += size
+	p.Loss -= feedbackLossWeight * p.Loss
+}
+
+// ObserveLoss feeds a packet sent over the path that was declared lost
+func (ps *PathStats) ObserveLoss(pf pan.PathFingerprint) {
+	ps.mtx.Lock()
+	defer ps.mtx.Unlock()
+	p := ps.record(pf)
+	p.Lost += 1
+	p.Loss += feedbackLossWeight * (1 - p.Loss)
+}
+
+// Performance returns the recent observations of the path
+func (ps *PathStats) Performance(pf pan.PathFingerprint) (PathPerformance, bool) {
+	ps.mtx.RLock()
+	defer ps.mtx.RUnlock()
+	p, ok := ps.paths[pf]
+	if !ok || time.Since(p.Updated) > pathStatsTimeout {
+		return PathPerformance{}, false
+	}
+	return *p, true
+}
+
+// Latency estimates the one-way latency of the path as half its smoothed RTT
+func (ps *PathStats) Latency(pf pan.PathFingerprint) (time.Duration, bool) {
+	p, ok := ps.Performance(pf)
+	if !ok || p.RTT == 0 {
+		return 0, false
+	}
+	return p.RTT / 2, true
+}
+
+// Loss returns the smoothed share of packets lost on the path
+func (ps *PathStats) Loss(pf pan.PathFingerprint) (float64, bool) {
+	p, ok := ps.Performance(pf)
+	return p.Loss, ok
+}
+
+// quicConfig returns a copy of cfg whose connections feed their observations per path
+// into the PathStats of the connection
+func (c *meteredConn) quicConfig(cfg *quic.Config) *quic.Config {
+	if cfg == nil {
+		cfg = &quic.Config{}
+	} else {
+		cfg = cfg.Clone()
+	}
+	tracer := cfg.Tracer
+	cfg.Tracer = func(ctx context.Context, p logging.Perspective, id quic.ConnectionID) logging.ConnectionTracer {
+		ft := &feedbackTracer{
+			conn:  c,
+			sent:  make(map[logging.PacketNumber]sentPacket),
+			acked: make(map[logging.PacketNumber]sentPacket),
+		}
+		if tracer != nil {
+			if t := tracer(ctx, p, id); t != nil {
+				return logging.NewMultiplexedConnectionTracer(ft, t)
+			}
+		}
+		return ft
+	}
+	return cfg
+}
+
+/*
+QUIC does not know over which path its packets are sent, the path is chosen per packet
+when the packet is written to the SCION connection. The packets of a connection are
+written in the order they are sent, so every write to a remote is matched with the
+oldest sent packet to this remote of the same size that has not been written yet.
+Short header packets coalesced with long header packets during the handshake are
+never written on their own and are skipped.
+*/
+type pendingPacket struct {
+	tracer *feedbackTracer
+	pn     logging.PacketNumber
+	size   int
+	sent   time.Time
+}
+
+type sentPacket struct {
+	pf   pan.PathFingerprint
+	size int
+	sent time.Time
+}
+
+// expect queues a packet sent to remote that is about to be written
+func (c *meteredConn) expect(remote pan.UDPAddr, p pendingPacket) {
+	c.pendingMtx.Lock()
+	defer c.pendingMtx.Unlock()
+	if c.pending == nil {
+		c.pending = make(map[pan.UDPAddr][]pendingPacket)
+	}
+	c.pending[remote] = append(c.pending[remote], p)
+}
+
+// forget drops the packets of a closed QUIC connection that were never written,
+// the queue of a remote that went away would otherwise be kept forever
+func (c *meteredConn) forget(remote pan.UDPAddr, t *feedbackTracer) {
+	c.pendingMtx.Lock()
+	defer c.pendingMtx.Unlock()
+	var kept []pendingPacket
+	for _, p := range c.pending[remote] {
+		if p.tracer != t {
+			kept = append(kept, p)
+		}
+	}
+	if len(kept) == 0 {
+		delete(c.pending, remote)
+	} else {
+		c.pending[remote] = kept
+	}
+}
+
+// bind tells the connection of the packet written to remote over the path
+func (c *meteredConn) bind(remote pan.UDPAddr, size int, path *pan.Path) {
+	c.pendingMtx.Lock()
+	queue := c.pending[remote]
+	now := time.Now()
+	for len(queue) > 0 && now.Sub(queue[0].sent) > feedbackBindTimeout {
+		queue = queue[1:]
+	}
+	var p pendingPacket
+	matched := false
+	// packets skipped before the match were coalesced with long header packets
+	for i := 0; i < len(queue) && i < feedbackBindLookahead; i++ {
+		if queue[i].size == size {
+			p, matched = queue[i], true
+			queue = queue[i+1:]
+			break
+		}
+	}
+	if len(queue) == 0 {
+		delete(c.pending, remote)
+	} else {
+		c.pending[remote] = queue
+	}
+	c.pendingMtx.Unlock()
+
+	// packets to the local AS have no path
+	if matched && path != nil {
+		p.tracer.written(p.pn, sentPacket{pf: path.Fingerprint, size: size, sent: p.sent})
+	}
+}
+
+// feedbackTracer feeds the acknowledged and lost packets of a QUIC connection into PathStats
+type feedbackTracer struct {
+	logging.NullConnectionTracer
+	conn   *meteredConn
+	mtx    sync.Mutex
+	remote pan.UDPAddr
+	sent   map[logging.PacketNumber]sentPacket
+	// packets acknowledged by the packet being received
+	acked map[logging.PacketNumber]sentPacket
+}
+
+func (t *feedbackTracer) StartedConnection(local, remote net.Addr, srcConnID, destConnID logging.ConnectionID) {
+	if r, ok := remote.(pan.UDPAddr); ok {
+		t.mtx.Lock()
+		t.remote = r
+		t.mtx.Unlock()
+	}
+}
+
+// only short header packets are matched, long header packets may be coalesced into one datagram
+func (t *feedbackTracer) SentShortHeaderPacket(hdr *logging.ShortHeader, size logging.ByteCount, ack *logging.AckFrame, frames []logging.Frame) {
+	t.mtx.Lock()
+	remote := t.remote
+	t.mtx.Unlock()
+	t.conn.expect(remote, pendingPacket{tracer: t, pn: hdr.PacketNumber, size: int(size), sent: time.Now()})
+}
+
+// Close is called once the QUIC connection is closed, including by an idle timeout
+func (t *feedbackTracer) Close() {
+	t.mtx.Lock()
+	remote := t.remote
+	t.sent = make(map[logging.PacketNumber]sentPacket)
+	t.mtx.Unlock()
+	t.conn.forget(remote, t)
+}
+
+func (t *feedbackTracer) written(pn logging.PacketNumber, p sentPacket) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.sent[pn] = p
+}
+
+// the largest packet number newly acknowledged by an ACK frame yields an RTT sample,
+// corrected by the delay the peer reports for the acknowledgement. Received packets
+// are traced after their frames have been handled.
+func (t *feedbackTracer) ReceivedShortHeaderPacket(hdr *logging.ShortHeader, size logging.ByteCount, frames []logging.Frame) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	defer t.forgetAcked()
+	for _, f := range frames {
+		ack, ok := f.(*logging.AckFrame)
+		if !ok {
+			continue
+		}
+		p, ok := t.acked[ack.LargestAcked()]
+		if !ok {
+			continue
+		}
+		rtt := time.Since(p.sent)
+		if rtt > ack.DelayTime {
+			rtt -= ack.DelayTime
+		}
+		t.conn.stats.ObserveRTT(p.pf, rtt)
+	}
+}
+
+// acknowledgements in handshake packets yield no RTT sample
+func (t *feedbackTracer) ReceivedLongHeaderPacket(hdr *logging.ExtendedHeader, size logging.ByteCount, frames []logging.Frame) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.forgetAcked()
+}
+
+// forgetAcked is called once a received packet has been traced, the caller must hold mtx
+func (t *feedbackTracer) forgetAcked() {
+	for pn := range t.acked {
+		delete(t.acked, pn)
+	}
+}
+
+func (t *feedbackTracer) AcknowledgedPacket(encLevel logging.EncryptionLevel, pn logging.PacketNumber) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if p, ok := t.sent[pn]; ok {
+		delete(t.sent, pn)
+		t.acked[pn] = p
+		t.conn.stats.ObserveDelivered(p.pf, uint64(p.size))
+	}
+}
+
+func (t *feedbackTracer) LostPacket(encLevel logging.EncryptionLevel, pn logging.PacketNumber, reason logging.PacketLossReason) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if p, ok := t.sent[pn]; ok {
+		delete(t.sent, pn)
+		t.conn.stats.ObserveLoss(p.pf)
+	}
+}
+
+// measurements combines measured latencies and loss rates of several sources,
+// the first source that measured a path is used
+type measurements []interface {
+	LatencyEstimator
+	LossEstimator
+}
+
+func (m measurements) Latency(pf pan.PathFingerprint) (time.Duration, bool) {
+	for _, src := range m {
+		if lat, ok := src.Latency(pf); ok {
+			return lat, true
+		}
+	}
+	return 0, false
+}
+
+func (m measurements) Loss(pf pan.PathFingerprint) (float64, bool) {
+	for _, src := range m {
+		if loss, ok := src.Loss(pf); ok {
+			return loss, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/quic-go/quic-go/logging"
+)
+
+// newTestTracer returns the tracer of a QUIC connection to remote on c
+func newTestTracer(c *meteredConn, remote pan.UDPAddr) *feedbackTracer {
+	t := &feedbackTracer{
+		conn:  c,
+		sent:  make(map[logging.PacketNumber]sentPacket),
+		acked: make(map[logging.PacketNumber]sentPacket),
+	}
+	t.StartedConnection(nil, remote, logging.ConnectionID{}, logging.ConnectionID{})
+	return t
+}
+
+func sendPacket(t *feedbackTracer, pn logging.PacketNumber, size int) {
+	t.SentShortHeaderPacket(&logging.ShortHeader{PacketNumber: pn}, logging.ByteCount(size), nil, nil)
+}
+
+// pathOf returns the path the packet was bound to
+func pathOf(t *feedbackTracer, pn logging.PacketNumber) pan.PathFingerprint {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return t.sent[pn].pf
+}
+
+func TestFeedbackBind(t *testing.T) {
+	a, b := testPath(1, 2), testPath(3, 4)
+	remote := testRemote(1)
+
+	type write struct {
+		size int
+		path *pan.Path
+	}
+	tests := []struct {
+		name string
+		// sizes of the sent packets numbered from 0
+		sent    []int
+		written []write
+		// path per packet number, packets not written are missing
+		expected map[logging.PacketNumber]*pan.Path
+		// number of packets still waiting for their write
+		pending int
+	}{
+		{
+			name:     "in order",
+			sent:     []int{100, 100, 200},
+			written:  []write{{100, a}, {100, b}, {200, a}},
+			expected: map[logging.PacketNumber]*pan.Path{0: a, 1: b, 2: a},
+		},
+		{
+			name:     "coalesced packets are skipped",
+			sent:     []int{50, 60, 100, 100},
+			written:  []write{{100, a}, {100, b}},
+			expected: map[logging.PacketNumber]*pan.Path{2: a, 3: b},
+		},
+		{
+			name:     "not yet written",
+			sent:     []int{100, 200, 300},
+			written:  []write{{100, a}},
+			expected: map[logging.PacketNumber]*pan.Path{0: a},
+			pending:  2,
+		},
+		{
+			name:     "beyond the lookahead",
+			sent:     []int{50, 50, 50, 50, 50, 50, 50, 50, 100},
+			written:  []write{{100, a}},
+			expected: map[logging.PacketNumber]*pan.Path{},
+			pending:  feedbackBindLookahead + 1,
+		},
+		{
+			name:     "unknown size",
+			sent:     []int{100},
+			written:  []write{{70, a}, {100, b}},
+			expected: map[logging.PacketNumber]*pan.Path{0: b},
+		},
+		{
+			name:     "no path within the local AS",
+			sent:     []int{100, 100},
+			written:  []write{{100, nil}, {100, a}},
+			expected: map[logging.PacketNumber]*pan.Path{1: a},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &meteredConn{stats: NewPathStats()}
+			ft := newTestTracer(c, remote)
+			for pn, size := range tt.sent {
+				sendPacket(ft, logging.PacketNumber(pn), size)
+			}
+			for _, w := range tt.written {
+				c.bind(remote, w.size, w.path)
+			}
+			for pn := range tt.sent {
+				var pf pan.PathFingerprint
+				if p, ok := tt.expected[logging.PacketNumber(pn)]; ok {
+					pf = p.Fingerprint
+				}
+				if got := pathOf(ft, logging.PacketNumber(pn)); got != pf {
+					t.Errorf("packet %d bound to %q, expected %q", pn, got, pf)
+				}
+			}
+			if n := len(c.pending[remote]); n != tt.pending {
+				t.Errorf("%d packets pending, expected %d", n, tt.pending)
+			}
+		})
+	}
+}
+
+func TestFeedbackBindTimeout(t *testing.T) {
+	a := testPath(1, 2)
+	remote := testRemote(1)
+	c := &meteredConn{stats: NewPathStats()}
+	ft := newTestTracer(c, remote)
+	c.expect(remote, pendingPacket{tracer: ft, pn: 0, size: 100, sent: time.Now().Add(-2 * feedbackBindTimeout)})
+	sendPacket(ft, 1, 100)
+
+	// a packet that was never written in time is not matched
+	c.bind(remote, 100, a)
+	if pathOf(ft, 0) != "" || pathOf(ft, 1) != a.Fingerprint {
+		t.Errorf("packets bound to %q and %q, expected only the recent one", pathOf(ft, 0), pathOf(ft, 1))
+	}
+	if _, ok := c.pending[remote]; ok {
+		t.Error("queue of the remote kept after all packets were matched")
+	}
+}
+
+func TestFeedbackRemotes(t *testing.T) {
+	a, b := testPath(1, 2), testPath(3, 4)
+	c := &meteredConn{stats: NewPathStats()}
+	ft1, ft2 := newTestTracer(c, testRemote(1)), newTestTracer(c, testRemote(2))
+	sendPacket(ft1, 0, 100)
+	sendPacket(ft2, 0, 100)
+
+	// writes are matched with the packets to their remote
+	c.bind(testRemote(2), 100, b)
+	c.bind(testRemote(1), 100, a)
+	if pathOf(ft1, 0) != a.Fingerprint || pathOf(ft2, 0) != b.Fingerprint {
+		t.Errorf("packets bound to %q and %q, expected %q and %q", pathOf(ft1, 0), pathOf(ft2, 0), a.Fingerprint, b.Fingerprint)
+	}
+}
+
+func TestFeedbackClose(t *testing.T) {
+	a := testPath(1, 2)
+	remote := testRemote(1)
+	c := &meteredConn{stats: NewPathStats()}
+	closed, open := newTestTracer(c, remote), newTestTracer(c, remote)
+	sendPacket(closed, 0, 100)
+	sendPacket(open, 0, 200)
+
+	// the unwritten packets of a closed connection are not matched with later writes
+	closed.Close()
+	if n := len(c.pending[remote]); n != 1 {
+		t.Fatalf("%d packets pending after closing a connection, expected 1", n)
+	}
+	c.bind(remote, 100, a)
+	c.bind(remote, 200, a)
+	if pathOf(closed, 0) != "" || pathOf(open, 0) != a.Fingerprint {
+		t.Errorf("packets bound to %q and %q, expected only the one of the open connection", pathOf(closed, 0), pathOf(open, 0))
+	}
+
+	// the queue of a remote without connections is dropped
+	sendPacket(open, 1, 100)
+	open.Close()
+	if _, ok := c.pending[remote]; ok {
+		t.Error("queue of the remote kept after its connections closed")
+	}
+}
+
+func TestFeedbackLoss(t *testing.T) {
+	a, b := testPath(1, 2), testPath(3, 4)
+	remote := testRemote(1)
+	c := &meteredConn{stats: NewPathStats()}
+	ft := newTestTracer(c, remote)
+	for pn, p := range []*pan.Path{a, b, a} {
+		sendPacket(ft, logging.PacketNumber(pn), 100)
+		c.bind(remote, 100, p)
+	}
+
+	ft.AcknowledgedPacket(logging.Encryption1RTT, 0)
+	ft.LostPacket(logging.Encryption1RTT, 1, logging.PacketLossTimeThreshold)
+	ft.LostPacket(logging.Encryption1RTT, 2, logging.PacketLossReorderingThreshold)
+	// packets that were not sent over a path or are already handled are ignored
+	ft.LostPacket(logging.Encryption1RTT, 2, logging.PacketLossTimeThreshold)
+	ft.LostPacket(logging.Encryption1RTT, 7, logging.PacketLossTimeThreshold)
+	ft.AcknowledgedPacket(logging.Encryption1RTT, 0)
+
+	tests := []struct {
+		path      *pan.Path
+		delivered uint64
+		lost      uint64
+		loss      float64
+	}{
+		// the loss of a path rises by the loss weight per lost packet
+		{a, 100, 1, feedbackLossWeight},
+		{b, 0, 1, feedbackLossWeight},
+	}
+	for _, tt := range tests {
+		perf, ok := c.stats.Performance(tt.path.Fingerprint)
+		if !ok || perf.Delivered != tt.delivered || perf.Lost != tt.lost || perf.Loss != tt.loss {
+			t.Errorf("path %s delivered %d, lost %d at a loss of %f, expected %d, %d and %f",
+				tt.path.Fingerprint, perf.Delivered, perf.Lost, perf.Loss, tt.delivered, tt.lost, tt.loss)
+		}
+	}
+	if rtt := c.stats.paths[a.Fingerprint].RTT; rtt != 0 {
+		t.Errorf("RTT %s without a received ACK frame", rtt)
+	}
+}
+
+func TestFeedbackRTT(t *testing.T) {
+	a, b := testPath(1, 2), testPath(3, 4)
+	remote := testRemote(1)
+	c := &meteredConn{stats: NewPathStats()}
+	ft := newTestTracer(c, remote)
+	sent := time.Now().Add(-100 * time.Millisecond)
+	c.expect(remote, pendingPacket{tracer: ft, pn: 0, size: 100, sent: sent})
+	c.bind(remote, 100, a)
+	c.expect(remote, pendingPacket{tracer: ft, pn: 1, size: 100, sent: sent})
+	c.bind(remote, 100, b)
+
+	// the largest newly acknowledged packet yields the sample, corrected by the ACK delay
+	ft.AcknowledgedPacket(logging.Encryption1RTT, 0)
+	ft.AcknowledgedPacket(logging.Encryption1RTT, 1)
+	ack := &logging.AckFrame{AckRanges: []logging.AckRange{{Smallest: 0, Largest: 1}}, DelayTime: 20 * time.Millisecond}
+	ft.ReceivedShortHeaderPacket(&logging.ShortHeader{}, 50, []logging.Frame{ack})
+	if rtt := c.stats.paths[b.Fingerprint].RTT; rtt < 80*time.Millisecond || rtt > time.Since(sent) {
+		t.Errorf("RTT %s over the largest acknowledged path, expected 80ms", rtt)
+	}
+	if rtt := c.stats.paths[a.Fingerprint].RTT; rtt != 0 {
+		t.Errorf("RTT %s over a smaller acknowledged packet", rtt)
+	}
+	if latency, ok := c.stats.Latency(b.Fingerprint); !ok || latency != c.stats.paths[b.Fingerprint].RTT/2 {
+		t.Errorf("latency %s, expected half the RTT", latency)
+	}
+
+	// an ACK frame repeating an acknowledgement yields no sample
+	ft.ReceivedShortHeaderPacket(&logging.ShortHeader{}, 50, []logging.Frame{ack})
+	if len(ft.acked) != 0 {
+		t.Errorf("%d acknowledged packets kept after receiving a packet", len(ft.acked))
+	}
+	c.stats.paths[b.Fingerprint].RTT = 0
+	ft.ReceivedShortHeaderPacket(&logging.ShortHeader{}, 50, []logging.Frame{ack})
+	if rtt := c.stats.paths[b.Fingerprint].RTT; rtt != 0 {
+		t.Errorf("RTT %s from a repeated acknowledgement", rtt)
+	}
+}
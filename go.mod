@@ -1,10 +1,11 @@
 module github.com/nils-treuheit/scion-cdn
 
-go 1.20
+go 1.21
 
 require (
-	github.com/gorilla/handlers v1.5.2
 	github.com/netsec-ethz/scion-apps v0.5.1-0.20231107140149-3afc9a911808
+	github.com/prometheus/client_golang v1.14.0
+	github.com/quic-go/quic-go v0.38.1
 	github.com/scionproto/scion v0.9.1
 )
 
@@ -16,7 +17,6 @@ require (
 	github.com/dchest/cmac v1.0.0 // indirect
 	github.com/dustin/go-humanize v1.0.1 // indirect
 	github.com/fatih/color v1.14.1 // indirect
-	github.com/felixge/httpsnoop v1.0.3 // indirect
 	github.com/go-stack/stack v1.8.0 // indirect
 	github.com/go-task/slim-sprig v0.0.0-20230315185526-52ccab3ef572 // indirect
 	github.com/golang/mock v1.6.0 // indirect
@@ -37,12 +37,11 @@ require (
 	github.com/onsi/ginkgo/v2 v2.9.5 // indirect
 	github.com/opentracing/opentracing-go v1.2.0 // indirect
 	github.com/pelletier/go-toml v1.9.5 // indirect
-	github.com/prometheus/client_golang v1.14.0 // indirect
 	github.com/prometheus/client_model v0.3.0 // indirect
 	github.com/prometheus/common v0.37.0 // indirect
 	github.com/prometheus/procfs v0.8.0 // indirect
+	github.com/quic-go/qpack v0.4.0 // indirect
 	github.com/quic-go/qtls-go1-20 v0.3.3 // indirect
-	github.com/quic-go/quic-go v0.38.1 // indirect
 	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
 	github.com/uber/jaeger-client-go v2.30.0+incompatible // indirect
 	github.com/uber/jaeger-lib v2.0.0+incompatible // indirect
@@ -72,4 +71,4 @@ require (
 	modernc.org/token v1.0.1 // indirect
 )
 
-replace github.com/netsec-ethz/scion-apps => /home/nils-z/scion-apps/
+replace github.com/netsec-ethz/scion-apps => ./third_party/scion-apps
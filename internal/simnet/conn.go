@@ -0,0 +1,255 @@
+package simnet
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/quic-go/quic-go"
+)
+
+// maximum size of a received datagram including the header
+const maxPacketSize = 1<<16 - 1
+
+var errBadDstAddress = errors.New("dst address not a pan.UDPAddr")
+
+// socket is a loopback UDP socket in one of the ASes of the network
+type socket struct {
+	n     *Network
+	raw   *net.UDPConn
+	local pan.UDPAddr
+	buf   sync.Pool
+}
+
+// open binds a loopback socket in the AS ia, an unspecified IP binds to 127.0.0.1
+func (n *Network) open(ia pan.IA, local netip.AddrPort) (*socket, error) {
+	if !local.Addr().IsValid() || local.Addr().IsUnspecified() {
+		local = netip.AddrPortFrom(netip.AddrFrom4([4]byte{127, 0, 0, 1}), local.Port())
+	}
+	raw, err := net.ListenUDP("udp", net.UDPAddrFromAddrPort(local))
+	if err != nil {
+		return nil, err
+	}
+	bound := raw.LocalAddr().(*net.UDPAddr).AddrPort()
+	return &socket{
+		n:     n,
+		raw:   raw,
+		local: pan.UDPAddr{IA: ia, IP: bound.Addr().Unmap(), Port: bound.Port()},
+		buf:   sync.Pool{New: func() interface{} { return make([]byte, maxPacketSize) }},
+	}, nil
+}
+
+// read returns the next packet of the network, datagrams of other senders are skipped
+func (s *socket) read(b []byte) (int, pan.UDPAddr, *pan.Path, error) {
+	pkt := s.buf.Get().([]byte)
+	defer s.buf.Put(pkt)
+	for {
+		m, from, err := s.raw.ReadFromUDPAddrPort(pkt)
+		if err != nil {
+			return 0, pan.UDPAddr{}, nil, err
+		}
+		if n, remote, path, ok := s.n.receive(pkt[:m], from, b); ok {
+			return n, remote, path, nil
+		}
+	}
+}
+
+func (s *socket) write(b []byte, dst pan.UDPAddr, path *pan.Path) (int, error) {
+	return s.n.send(s.raw, s.local.IA, dst, path, b)
+}
+
+func (s *socket) LocalAddr() net.Addr {
+	return s.local
+}
+
+func (s *socket) SetDeadline(t time.Time) error {
+	return s.raw.SetDeadline(t)
+}
+
+func (s *socket) SetReadDeadline(t time.Time) error {
+	return s.raw.SetReadDeadline(t)
+}
+
+func (s *socket) SetWriteDeadline(t time.Time) error {
+	return s.raw.SetWriteDeadline(t)
+}
+
+// listenConn is the simulated counterpart of the listening connection of pan
+type listenConn struct {
+	*socket
+	selector pan.ReplySelector
+}
+
+// ListenUDP listens in the AS of the servers like pan.ListenUDP does,
+// the reply selector learns the paths of the clients from the simulated network
+func (n *Network) ListenUDP(local netip.AddrPort, selector pan.ReplySelector) (pan.ListenConn, error) {
+	if selector == nil {
+		selector = pan.NewDefaultReplySelector()
+	}
+	s, err := n.open(n.server, local)
+	if err != nil {
+		return nil, err
+	}
+	selector.Initialize(s.local)
+	return &listenConn{socket: s, selector: selector}, nil
+}
+
+func (c *listenConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, remote, _, err := c.ReadFromVia(b)
+	return n, remote, err
+}
+
+func (c *listenConn) ReadFromVia(b []byte) (int, pan.UDPAddr, *pan.Path, error) {
+	n, remote, path, err := c.read(b)
+	if err != nil {
+		return n, pan.UDPAddr{}, nil, err
+	}
+	c.selector.Record(remote, path)
+	return n, remote, path, nil
+}
+
+func (c *listenConn) WriteTo(b []byte, dst net.Addr) (int, error) {
+	sdst, ok := dst.(pan.UDPAddr)
+	if !ok {
+		return 0, errBadDstAddress
+	}
+	var path *pan.Path
+	if c.local.IA != sdst.IA {
+		path = c.selector.Path(sdst)
+		if path == nil {
+			return 0, errNoPath
+		}
+	}
+	return c.WriteToVia(b, sdst, path)
+}
+
+func (c *listenConn) WriteToVia(b []byte, dst pan.UDPAddr, path *pan.Path) (int, error) {
+	return c.write(b, dst, path)
+}
+
+func (c *listenConn) Close() error {
+	_ = c.selector.Close()
+	return c.raw.Close()
+}
+
+// dialedConn is the simulated counterpart of the dialed connection of pan
+type dialedConn struct {
+	*socket
+	remote   pan.UDPAddr
+	mtx      sync.Mutex
+	policy   pan.Policy
+	selector pan.Selector
+}
+
+// DialUDP dials from the AS of the clients to the servers like pan.DialUDP does, the
+// selector chooses among the paths of the simulated network filtered by the policy
+func (n *Network) DialUDP(local netip.AddrPort, remote pan.UDPAddr, policy pan.Policy, selector pan.Selector) (pan.Conn, error) {
+	if selector == nil {
+		selector = pan.NewDefaultSelector()
+	}
+	s, err := n.open(n.client, local)
+	if err != nil {
+		return nil, err
+	}
+	c := &dialedConn{socket: s, remote: remote, policy: policy, selector: selector}
+	selector.Initialize(s.local, remote, c.paths())
+	return c, nil
+}
+
+// paths returns the paths to the remote allowed by the policy
+func (c *dialedConn) paths() []*pan.Path {
+	paths := c.n.Paths(c.local.IA, c.remote.IA)
+	if c.policy != nil {
+		paths = c.policy.Filter(paths)
+	}
+	return paths
+}
+
+func (c *dialedConn) SetPolicy(policy pan.Policy) {
+	c.mtx.Lock()
+	c.policy = policy
+	paths := c.paths()
+	c.mtx.Unlock()
+	c.selector.Refresh(paths)
+}
+
+func (c *dialedConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+func (c *dialedConn) GetPath() *pan.Path {
+	return c.selector.Path()
+}
+
+func (c *dialedConn) Write(b []byte) (int, error) {
+	var path *pan.Path
+	if c.local.IA != c.remote.IA {
+		path = c.selector.Path()
+		if path == nil {
+			return 0, errNoPath
+		}
+	}
+	return c.WriteVia(path, b)
+}
+
+func (c *dialedConn) WriteVia(path *pan.Path, b []byte) (int, error) {
+	return c.write(b, c.remote, path)
+}
+
+func (c *dialedConn) Read(b []byte) (int, error) {
+	n, _, err := c.ReadVia(b)
+	return n, err
+}
+
+// ReadVia only returns packets of the remote
+func (c *dialedConn) ReadVia(b []byte) (int, *pan.Path, error) {
+	for {
+		n, remote, path, err := c.read(b)
+		if err != nil {
+			return n, nil, err
+		}
+		if remote == c.remote {
+			return n, path, nil
+		}
+	}
+}
+
+func (c *dialedConn) Close() error {
+	_ = c.selector.Close()
+	return c.raw.Close()
+}
+
+// connectedPacketConn lets QUIC use a dialed connection, like pan does
+type connectedPacketConn struct {
+	pan.Conn
+}
+
+func (c connectedPacketConn) WriteTo(b []byte, to net.Addr) (int, error) {
+	return c.Write(b)
+}
+
+func (c connectedPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, err := c.Read(b)
+	return n, c.RemoteAddr(), err
+}
+
+// DialQUIC dials a QUIC connection to the servers like pan.DialQUIC does
+func (n *Network) DialQUIC(ctx context.Context, local netip.AddrPort, remote pan.UDPAddr, policy pan.Policy, selector pan.Selector,
+	host string, tlsConf *tls.Config, quicConf *quic.Config) (*pan.QUICSession, error) {
+
+	conn, err := n.DialUDP(local, remote, policy, selector)
+	if err != nil {
+		return nil, err
+	}
+	session, err := quic.Dial(ctx, connectedPacketConn{conn}, remote, tlsConf, quicConf)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &pan.QUICSession{Connection: session, Conn: conn}, nil
+}
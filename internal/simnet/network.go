@@ -0,0 +1,222 @@
+package simnet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+/*
+Packets are sent as UDP datagrams over the loopback interface, the simulated SCION
+address of a socket is its loopback address in the AS of the servers or of the clients.
+Every datagram starts with a header carrying the IA of the sender and the path it was
+sent over, which the receiver reverses to reply.
+*/
+const (
+	headerLen = 10
+	// path index of packets within an AS
+	noPath = 0xffff
+)
+
+var errNoPath = errors.New("no simulated path")
+
+// Network simulates the paths of a topology
+type Network struct {
+	server, client pan.IA
+	paths          []*simPath
+	byFingerprint  map[pan.PathFingerprint]pathDirection
+	rndMtx         sync.Mutex
+	rnd            *rand.Rand
+}
+
+// simPath is a path of the topology with a link per direction,
+// such that requests and replies do not share the bandwidth
+type simPath struct {
+	cfg      PathConfig
+	forward  *pan.Path
+	reverse  *pan.Path
+	toClient link
+	toServer link
+}
+
+type pathDirection struct {
+	idx      int
+	toClient bool
+}
+
+// link queues the packets of one direction of a path for its bandwidth
+type link struct {
+	mtx  sync.Mutex
+	busy time.Time
+}
+
+// NewNetwork builds the simulated network of a validated topology, see LoadTopology
+func NewNetwork(topo *Topology) (*Network, error) {
+	if errs := topo.validate(); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid topology:\n%w", errors.Join(errs...))
+	}
+	server, _ := pan.ParseIA(topo.ServerIA)
+	client, _ := pan.ParseIA(topo.ClientIA)
+	n := &Network{
+		server:        server,
+		client:        client,
+		byFingerprint: make(map[pan.PathFingerprint]pathDirection),
+		rnd:           rand.New(rand.NewSource(topo.Seed)),
+	}
+	for i, pc := range topo.Paths {
+		ifs := pc.interfaces(i, server, client)
+		sp := &simPath{
+			cfg:     pc,
+			forward: newPath(server, client, ifs, pc),
+			reverse: newPath(client, server, reversed(ifs), pc),
+		}
+		for _, p := range []*pan.Path{sp.forward, sp.reverse} {
+			if _, ok := n.byFingerprint[p.Fingerprint]; ok {
+				return nil, fmt.Errorf("paths[%d]: path %s is not unique", i, p.Fingerprint)
+			}
+		}
+		n.byFingerprint[sp.forward.Fingerprint] = pathDirection{idx: i, toClient: true}
+		n.byFingerprint[sp.reverse.Fingerprint] = pathDirection{idx: i, toClient: false}
+		n.paths = append(n.paths, sp)
+	}
+	return n, nil
+}
+
+// ServerIA returns the AS the servers listen in
+func (n *Network) ServerIA() pan.IA {
+	return n.server
+}
+
+// ClientIA returns the AS the clients dial from
+func (n *Network) ClientIA() pan.IA {
+	return n.client
+}
+
+// Paths returns the paths from src to dst in the order of the topology
+func (n *Network) Paths(src, dst pan.IA) []*pan.Path {
+	var paths []*pan.Path
+	for _, sp := range n.paths {
+		switch {
+		case src == n.server && dst == n.client:
+			paths = append(paths, sp.forward)
+		case src == n.client && dst == n.server:
+			paths = append(paths, sp.reverse)
+		}
+	}
+	return paths
+}
+
+// RTT returns the round trip time over the path without queueing
+func (n *Network) RTT(pf pan.PathFingerprint) (time.Duration, bool) {
+	pd, ok := n.byFingerprint[pf]
+	if !ok {
+		return 0, false
+	}
+	return 2 * time.Duration(n.paths[pd.idx].cfg.Latency), true
+}
+
+// send passes the packet from src to dst over the path, which has to lead from the AS
+// of src to the AS of dst. Packets that are dropped on the path count as sent.
+func (n *Network) send(raw *net.UDPConn, src pan.IA, dst pan.UDPAddr, path *pan.Path, b []byte) (int, error) {
+	idx := noPath
+	var sp *simPath
+	var l *link
+	if src != dst.IA {
+		if path == nil {
+			return 0, fmt.Errorf("%w to %s", errNoPath, dst.IA)
+		}
+		pd, ok := n.byFingerprint[path.Fingerprint]
+		if !ok || (pd.toClient && (src != n.server || dst.IA != n.client)) ||
+			(!pd.toClient && (src != n.client || dst.IA != n.server)) {
+			return 0, fmt.Errorf("%w %s from %s to %s", errNoPath, path.Fingerprint, src, dst.IA)
+		}
+		idx, sp = pd.idx, n.paths[pd.idx]
+		l = &sp.toServer
+		if pd.toClient {
+			l = &sp.toClient
+		}
+	}
+
+	pkt := make([]byte, headerLen+len(b))
+	binary.BigEndian.PutUint64(pkt, uint64(src))
+	binary.BigEndian.PutUint16(pkt[8:], uint16(idx))
+	copy(pkt[headerLen:], b)
+	to := net.UDPAddrFromAddrPort(netip.AddrPortFrom(dst.IP, dst.Port))
+	if sp == nil {
+		_, err := raw.WriteToUDP(pkt, to)
+		return len(b), err
+	}
+
+	if len(b) > sp.cfg.mtu() || n.lost(sp.cfg.Loss) {
+		return len(b), nil
+	}
+	delay, ok := l.enqueue(len(b), sp.cfg)
+	if !ok {
+		return len(b), nil
+	}
+	time.AfterFunc(delay, func() {
+		// the socket may have been closed in the meantime, like packets in flight get lost
+		_, _ = raw.WriteToUDP(pkt, to)
+	})
+	return len(b), nil
+}
+
+func (n *Network) lost(loss float64) bool {
+	if loss <= 0 {
+		return false
+	}
+	n.rndMtx.Lock()
+	defer n.rndMtx.Unlock()
+	return n.rnd.Float64() < loss
+}
+
+// enqueue returns the delay until a packet of size bytes arrives at the end of the path,
+// packets that would queue for longer than the queue of the path are dropped
+func (l *link) enqueue(size int, pc PathConfig) (time.Duration, bool) {
+	now := time.Now()
+	if pc.Bandwidth == 0 {
+		return time.Duration(pc.Latency), true
+	}
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	start := l.busy
+	if start.Before(now) {
+		start = now
+	}
+	if start.Sub(now) > pc.queue() {
+		return 0, false
+	}
+	// Kbit/s
+	l.busy = start.Add(time.Duration(float64(size*8) / float64(pc.Bandwidth*1000) * float64(time.Second)))
+	return l.busy.Sub(now) + time.Duration(pc.Latency), true
+}
+
+// receive copies the payload of a packet received from a socket into b,
+// returning the sender and the path to reply over
+func (n *Network) receive(pkt []byte, from netip.AddrPort, b []byte) (int, pan.UDPAddr, *pan.Path, bool) {
+	if len(pkt) < headerLen {
+		return 0, pan.UDPAddr{}, nil, false
+	}
+	ia := pan.IA(binary.BigEndian.Uint64(pkt))
+	idx := int(binary.BigEndian.Uint16(pkt[8:]))
+	var path *pan.Path
+	if idx != noPath {
+		if idx >= len(n.paths) {
+			return 0, pan.UDPAddr{}, nil, false
+		}
+		// reply over the same path in the opposite direction
+		path = n.paths[idx].forward
+		if ia == n.server {
+			path = n.paths[idx].reverse
+		}
+	}
+	remote := pan.UDPAddr{IA: ia, IP: from.Addr().Unmap(), Port: from.Port()}
+	return copy(b, pkt[headerLen:]), remote, path, true
+}
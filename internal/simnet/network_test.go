@@ -0,0 +1,234 @@
+package simnet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+// testNetwork has a direct path with latency, a path losing every packet and a path over a transit AS
+func testNetwork(t *testing.T) *Network {
+	t.Helper()
+	n, err := NewNetwork(&Topology{
+		ServerIA: "1-ff00:0:110",
+		ClientIA: "1-ff00:0:111",
+		Paths: []PathConfig{
+			{Latency: Duration(20 * time.Millisecond), MTU: 1400},
+			{Loss: 1},
+			{
+				Interfaces: []string{"1-ff00:0:110#1", "1-ff00:0:112#2", "1-ff00:0:112#3", "1-ff00:0:111#4"},
+				Latency:    Duration(5 * time.Millisecond),
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func openSocket(t *testing.T, n *Network, ia pan.IA) *socket {
+	t.Helper()
+	s, err := n.open(ia, netip.AddrPort{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.raw.Close() })
+	return s
+}
+
+// readWithin reads the next packet of s, ok is false if none arrived in time
+func readWithin(t *testing.T, s *socket, timeout time.Duration) ([]byte, pan.UDPAddr, *pan.Path, bool) {
+	t.Helper()
+	if err := s.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, maxPacketSize)
+	m, remote, path, err := s.read(b)
+	if err != nil {
+		return nil, pan.UDPAddr{}, nil, false
+	}
+	return b[:m], remote, path, true
+}
+
+func TestSendReplyPath(t *testing.T) {
+	n := testNetwork(t)
+	server, client := openSocket(t, n, n.ServerIA()), openSocket(t, n, n.ClientIA())
+	requestPaths, replyPaths := n.Paths(n.ClientIA(), n.ServerIA()), n.Paths(n.ServerIA(), n.ClientIA())
+
+	for _, idx := range []int{0, 2} {
+		request := requestPaths[idx]
+		latency := time.Duration(n.paths[idx].cfg.Latency)
+
+		start := time.Now()
+		if _, err := client.write([]byte("request"), server.local, request); err != nil {
+			t.Fatal(err)
+		}
+		b, remote, path, ok := readWithin(t, server, time.Second)
+		if !ok || string(b) != "request" || remote != client.local {
+			t.Fatalf("path %d: received %q from %s, %v, expected the request of %s", idx, b, remote, ok, client.local)
+		}
+		if elapsed := time.Since(start); elapsed < latency {
+			t.Errorf("path %d: request arrived after %v, before the latency of %v", idx, elapsed, latency)
+		}
+		// the reply goes back over the path the request came from
+		if path != replyPaths[idx] {
+			t.Fatalf("path %d: reply path %v, expected %s", idx, path, replyPaths[idx].Fingerprint)
+		}
+		expectReversed(t, path, request)
+
+		start = time.Now()
+		if _, err := server.write([]byte("reply"), remote, path); err != nil {
+			t.Fatal(err)
+		}
+		b, remote, path, ok = readWithin(t, client, time.Second)
+		if !ok || string(b) != "reply" || remote != server.local {
+			t.Fatalf("path %d: received %q from %s, %v, expected the reply of %s", idx, b, remote, ok, server.local)
+		}
+		if elapsed := time.Since(start); elapsed < latency {
+			t.Errorf("path %d: reply arrived after %v, before the latency of %v", idx, elapsed, latency)
+		}
+		if path != request {
+			t.Errorf("path %d: reply arrived with path %v, expected the request path %s", idx, path, request.Fingerprint)
+		}
+	}
+}
+
+func expectReversed(t *testing.T, path, of *pan.Path) {
+	t.Helper()
+	ifs, ofIfs := path.Metadata.Interfaces, of.Metadata.Interfaces
+	if len(ifs) != len(ofIfs) {
+		t.Fatalf("path %s is not the reverse of %s", path.Fingerprint, of.Fingerprint)
+	}
+	for i := range ifs {
+		if ifs[i] != ofIfs[len(ofIfs)-1-i] {
+			t.Fatalf("path %s is not the reverse of %s", path.Fingerprint, of.Fingerprint)
+		}
+	}
+}
+
+func TestSendDrops(t *testing.T) {
+	tests := []struct {
+		name      string
+		path      int
+		size      int
+		delivered bool
+	}{
+		{"within the mtu", 0, 1400, true},
+		{"above the mtu", 0, 1401, false},
+		{"above the default mtu", 2, defaultMTU + 1, false},
+		{"lost", 1, 10, false},
+	}
+	n := testNetwork(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := openSocket(t, n, n.ServerIA()), openSocket(t, n, n.ClientIA())
+			payload := bytes.Repeat([]byte{'x'}, tt.size)
+			// dropped packets count as sent
+			written, err := client.write(payload, server.local, n.Paths(n.ClientIA(), n.ServerIA())[tt.path])
+			if err != nil || written != tt.size {
+				t.Fatalf("wrote %d bytes, %v, expected %d", written, err, tt.size)
+			}
+			b, _, _, ok := readWithin(t, server, 200*time.Millisecond)
+			if ok != tt.delivered || (ok && !bytes.Equal(b, payload)) {
+				t.Errorf("received %d bytes, %v, expected delivered %v", len(b), ok, tt.delivered)
+			}
+		})
+	}
+}
+
+func TestSendErrors(t *testing.T) {
+	n := testNetwork(t)
+	server, client := openSocket(t, n, n.ServerIA()), openSocket(t, n, n.ClientIA())
+	unknown := &pan.Path{Fingerprint: "unknown"}
+
+	tests := []struct {
+		name string
+		path *pan.Path
+	}{
+		{"no path", nil},
+		{"unknown path", unknown},
+		{"path of the opposite direction", n.Paths(n.ServerIA(), n.ClientIA())[0]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := client.write([]byte("request"), server.local, tt.path); !errors.Is(err, errNoPath) {
+				t.Errorf("got %v, expected no path", err)
+			}
+		})
+	}
+
+	// packets within an AS need no path and arrive without one
+	other := openSocket(t, n, n.ServerIA())
+	if _, err := other.write([]byte("local"), server.local, nil); err != nil {
+		t.Fatal(err)
+	}
+	b, remote, path, ok := readWithin(t, server, time.Second)
+	if !ok || string(b) != "local" || remote != other.local || path != nil {
+		t.Errorf("received %q from %s over %v, %v, expected a local packet from %s", b, remote, path, ok, other.local)
+	}
+}
+
+func TestReceiveMalformed(t *testing.T) {
+	n := testNetwork(t)
+	from := netip.MustParseAddrPort("127.0.0.1:1234")
+	outOfRange := make([]byte, headerLen)
+	binary.BigEndian.PutUint64(outOfRange, uint64(n.ClientIA()))
+	binary.BigEndian.PutUint16(outOfRange[8:], uint16(len(n.paths)))
+
+	for name, pkt := range map[string][]byte{"short": {1, 2, 3}, "unknown path": outOfRange} {
+		if _, _, _, ok := n.receive(pkt, from, make([]byte, 10)); ok {
+			t.Errorf("%s packet received", name)
+		}
+	}
+}
+
+func TestEnqueue(t *testing.T) {
+	queue := Duration(150 * time.Millisecond)
+	tests := []struct {
+		name string
+		pc   PathConfig
+		// delay of every packet of 1000 bytes sent at once, negative for dropped packets
+		delays []time.Duration
+	}{
+		{
+			name:   "unlimited bandwidth",
+			pc:     PathConfig{Latency: Duration(10 * time.Millisecond)},
+			delays: []time.Duration{10 * time.Millisecond, 10 * time.Millisecond, 10 * time.Millisecond},
+		},
+		{
+			// 1000 bytes take 100ms at 80 Kbit/s
+			name:   "queued for the bandwidth",
+			pc:     PathConfig{Latency: Duration(10 * time.Millisecond), Bandwidth: 80},
+			delays: []time.Duration{110 * time.Millisecond, 210 * time.Millisecond},
+		},
+		{
+			name:   "dropped at the queue limit",
+			pc:     PathConfig{Bandwidth: 80, Queue: &queue},
+			delays: []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, -1, -1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var l link
+			for i, expected := range tt.delays {
+				delay, ok := l.enqueue(1000, tt.pc)
+				if expected < 0 {
+					if ok {
+						t.Errorf("packet %d queued for %v, expected it dropped", i, delay)
+					}
+					continue
+				}
+				// the packets are not enqueued at the very same time
+				if !ok || delay > expected || delay < expected-10*time.Millisecond {
+					t.Errorf("packet %d delayed by %v, %v, expected %v", i, delay, ok, expected)
+				}
+			}
+		})
+	}
+}
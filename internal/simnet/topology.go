@@ -0,0 +1,215 @@
+// Package simnet simulates a multi-path SCION network between the servers and the clients
+// on the loopback interface, such that the servers can be benchmarked end-to-end on one
+// machine. Every path delays, rate limits and drops the packets sent over it as described
+// by a topology file.
+package simnet
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+const (
+	defaultMTU = 1472
+	// packets waiting longer than this for the bandwidth of a path are dropped
+	defaultQueue = 100 * time.Millisecond
+)
+
+// Topology describes the simulated paths between the AS of the servers and the AS of the clients
+type Topology struct {
+	ServerIA string `json:"server_ia"`
+	ClientIA string `json:"client_ia"`
+	// seeds the packet loss of all paths, such that runs are reproducible
+	Seed  int64        `json:"seed,omitempty"`
+	Paths []PathConfig `json:"paths"`
+}
+
+// PathConfig describes a path from the servers to the clients, the reverse path
+// from the clients to the servers behaves the same
+type PathConfig struct {
+	// interfaces along the path as IA#interface ID, defaults to a direct link
+	// between the server and the client AS over interfaces unique to the path
+	Interfaces []string `json:"interfaces,omitempty"`
+	// one-way propagation delay
+	Latency Duration `json:"latency"`
+	// bottleneck bandwidth in Kbit/s, zero for unlimited
+	Bandwidth uint64 `json:"bandwidth,omitempty"`
+	// share of randomly dropped packets
+	Loss float64 `json:"loss,omitempty"`
+	// packets larger than the MTU are dropped, defaults to 1472 bytes
+	MTU uint16 `json:"mtu,omitempty"`
+	// maximum queueing delay before packets are dropped, defaults to 100ms
+	Queue *Duration `json:"queue,omitempty"`
+	// hides the latency and bandwidth in the path metadata, as on many SCIONLab paths
+	Unannounced bool `json:"unannounced,omitempty"`
+}
+
+// Duration is a time.Duration in the format of time.ParseDuration, e.g. "10ms"
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// LoadTopology reads and validates a topology file
+func LoadTopology(file string) (*Topology, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var topo Topology
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&topo); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	if errs := topo.validate(); len(errs) > 0 {
+		return nil, fmt.Errorf("%s: invalid topology:\n%w", file, errors.Join(errs...))
+	}
+	return &topo, nil
+}
+
+func (topo *Topology) validate() []error {
+	var errs []error
+	server, err := pan.ParseIA(topo.ServerIA)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("server_ia: %w", err))
+	}
+	client, err := pan.ParseIA(topo.ClientIA)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("client_ia: %w", err))
+	}
+	if err == nil && server == client {
+		errs = append(errs, errors.New("client_ia: has to differ from server_ia"))
+	}
+	if len(topo.Paths) == 0 {
+		errs = append(errs, errors.New("paths: at least one path is needed"))
+	}
+	for i, pc := range topo.Paths {
+		at := fmt.Sprintf("paths[%d]", i)
+		if pc.Latency < 0 {
+			errs = append(errs, fmt.Errorf("%s: negative latency", at))
+		}
+		if pc.Loss < 0 || pc.Loss > 1 {
+			errs = append(errs, fmt.Errorf("%s: loss must be within [0, 1]", at))
+		}
+		if pc.Queue != nil && *pc.Queue < 0 {
+			errs = append(errs, fmt.Errorf("%s: negative queue", at))
+		}
+		if len(pc.Interfaces) == 1 || len(pc.Interfaces)%2 != 0 {
+			errs = append(errs, fmt.Errorf("%s: interfaces need an even number of at least two entries", at))
+			continue
+		}
+		ifs, err := parseInterfaces(pc.Interfaces)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", at, err))
+		} else if len(ifs) > 0 && (ifs[0].IA != server || ifs[len(ifs)-1].IA != client) {
+			errs = append(errs, fmt.Errorf("%s: interfaces have to lead from server_ia to client_ia", at))
+		}
+	}
+	return errs
+}
+
+// parseInterfaces parses interfaces of the form IA#interface ID, e.g. 1-ff00:0:110#2
+func parseInterfaces(interfaces []string) ([]pan.PathInterface, error) {
+	ifs := make([]pan.PathInterface, len(interfaces))
+	for i, s := range interfaces {
+		iaStr, idStr, ok := strings.Cut(s, "#")
+		if !ok {
+			return nil, fmt.Errorf("interface %q is not of the form IA#ID", s)
+		}
+		ia, err := pan.ParseIA(iaStr)
+		if err != nil {
+			return nil, fmt.Errorf("interface %q: %w", s, err)
+		}
+		id, err := strconv.ParseUint(idStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("interface %q: %w", s, err)
+		}
+		ifs[i] = pan.PathInterface{IA: ia, IfID: pan.IfID(id)}
+	}
+	return ifs, nil
+}
+
+// interfaces returns the interfaces of the i-th path from the servers to the clients
+func (pc PathConfig) interfaces(i int, server, client pan.IA) []pan.PathInterface {
+	if len(pc.Interfaces) > 0 {
+		// validated by LoadTopology
+		ifs, _ := parseInterfaces(pc.Interfaces)
+		return ifs
+	}
+	return []pan.PathInterface{
+		{IA: server, IfID: pan.IfID(2*i + 1)},
+		{IA: client, IfID: pan.IfID(2*i + 2)},
+	}
+}
+
+func (pc PathConfig) mtu() int {
+	if pc.MTU == 0 {
+		return defaultMTU
+	}
+	return int(pc.MTU)
+}
+
+func (pc PathConfig) queue() time.Duration {
+	if pc.Queue == nil {
+		return defaultQueue
+	}
+	return time.Duration(*pc.Queue)
+}
+
+// newPath creates the pan path over the interfaces, the latency is spread evenly over
+// the hops and every hop announces the bottleneck bandwidth
+func newPath(src, dst pan.IA, ifs []pan.PathInterface, pc PathConfig) *pan.Path {
+	hops := len(ifs) - 1
+	latency := make([]time.Duration, hops)
+	bandwidth := make([]uint64, hops)
+	if !pc.Unannounced {
+		for h := 0; h < hops; h++ {
+			latency[h] = time.Duration(pc.Latency) / time.Duration(hops)
+			bandwidth[h] = pc.Bandwidth
+		}
+	}
+	return &pan.Path{
+		Source:      src,
+		Destination: dst,
+		Metadata: &pan.PathMetadata{
+			Interfaces: append([]pan.PathInterface{}, ifs...),
+			MTU:        uint16(pc.mtu()),
+			Latency:    latency,
+			Bandwidth:  bandwidth,
+		},
+		Fingerprint: pan.PathSequenceFromInterfaces(ifs).Fingerprint(),
+		Expiry:      time.Now().Add(24 * 365 * time.Hour),
+	}
+}
+
+// reversed returns the interfaces in reverse order
+func reversed(ifs []pan.PathInterface) []pan.PathInterface {
+	rev := make([]pan.PathInterface, len(ifs))
+	for i, iface := range ifs {
+		rev[len(ifs)-1-i] = iface
+	}
+	return rev
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metrics of the reply path selection, served by the admin server on /metrics
+var (
+	replyPackets = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "scion_cdn",
+		Name:      "reply_packets_total",
+		Help:      "Reply packets sent, by selector, remote IA and chosen path.",
+	}, []string{"selector", "remote_ia", "path"})
+	replyBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "scion_cdn",
+		Name:      "reply_bytes_total",
+		Help:      "Reply bytes sent, by selector, remote IA and chosen path.",
+	}, []string{"selector", "remote_ia", "path"})
+	pathDownEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "scion_cdn",
+		Name:      "path_down_total",
+		Help:      "PathDown notifications received, by selector.",
+	}, []string{"selector"})
+	pathQueries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "scion_cdn",
+		Name:      "path_queries_total",
+		Help:      "Path queries, by selector, remote IA and reason (record, refresh, pathdown).",
+	}, []string{"selector", "remote_ia", "reason"})
+	pathRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "scion_cdn",
+		Name:      "path_rejections_total",
+		Help:      "Queried paths not used for replies, by selector, remote IA and reason (down, limit, selection or the rejecting policy).",
+	}, []string{"selector", "remote_ia", "reason"})
+	recordedRemotes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "scion_cdn",
+		Name:      "recorded_remotes",
+		Help:      "Remotes currently recorded, by selector.",
+	}, []string{"selector"})
+	availablePaths = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "scion_cdn",
+		Name:      "available_paths",
+		Help:      "Reply paths currently recorded over all remotes, by selector.",
+	}, []string{"selector"})
+	pathRTT = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "scion_cdn",
+		Name:      "path_rtt_seconds",
+		Help:      "Smoothed round trip time of probed paths, by path.",
+	}, []string{"path"})
+	pathLoss = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "scion_cdn",
+		Name:      "path_loss_ratio",
+		Help:      "Smoothed share of lost probes of probed paths, by path.",
+	}, []string{"path"})
+)
+
+func init() {
+	prometheus.MustRegister(replyPackets, replyBytes, pathDownEvents, pathQueries,
+		pathRejections, recordedRemotes, availablePaths, pathRTT, pathLoss)
+}
+
+// namedSelector is implemented by the reply selectors labeling their metrics
+type namedSelector interface {
+	Name() string
+	SetName(name string)
+}
+
+// selectorName returns the metrics label of a reply selector
+func selectorName(rs pan.ReplySelector) string {
+	if ns, ok := rs.(namedSelector); ok {
+		return ns.Name()
+	}
+	return fmt.Sprintf("%T", rs)
+}
+
+// Name returns the selector label of the metrics, see SetName
+func (rrrs *RRReplySelector) Name() string {
+	return rrrs.name
+}
+
+// SetName sets the selector label of the metrics, defaults to the selector type.
+// Has to be set before the selector is initialized.
+func (rrrs *RRReplySelector) SetName(name string) {
+	rrrs.name = name
+}
+
+func (cbrs *CBReplySelector) Name() string {
+	return cbrs.rrrs.Name()
+}
+
+func (cbrs *CBReplySelector) SetName(name string) {
+	cbrs.rrrs.SetName(name)
+}
+
+func (srs *StrategicReplySelector) Name() string {
+	return srs.cbrs.rrrs.Name()
+}
+
+func (srs *StrategicReplySelector) SetName(name string) {
+	srs.cbrs.rrrs.SetName(name)
+}
+
+// class selectors are labeled <name>/<class>
+func (mrs *MuxReplySelector) Name() string {
+	return mrs.name
+}
+
+func (mrs *MuxReplySelector) SetName(name string) {
+	mrs.name = name
+	for class, s := range mrs.selectors {
+		if ns, ok := s.(namedSelector); ok {
+			ns.SetName(name + "/" + string(class))
+		}
+	}
+}
+
+// the name is passed on to the current and all later swapped in selectors
+func (srs *SwappableReplySelector) Name() string {
+	srs.mtx.RLock()
+	defer srs.mtx.RUnlock()
+	if srs.name == "" {
+		return selectorName(srs.current)
+	}
+	return srs.name
+}
+
+func (srs *SwappableReplySelector) SetName(name string) {
+	srs.mtx.Lock()
+	defer srs.mtx.Unlock()
+	srs.name = name
+	if ns, ok := srs.current.(namedSelector); ok {
+		ns.SetName(name)
+	}
+}
+
+// reject counts the paths to remote that were not kept for the given reason
+// and notes them in the decision, see pathtable.go
+func (rrrs *RRReplySelector) reject(remote pan.UDPAddr, d *pathDecision, reason string, paths, kept pan.PathsMRU) {
+	n := d.reject(paths, kept, func(*pan.Path) string { return reason })
+	if n > 0 {
+		pathRejections.WithLabelValues(rrrs.name, remote.IA.String(), reason).Add(float64(n))
+	}
+}
+
+// updateGauges publishes the number of recorded remotes and paths
+func (rrrs *RRReplySelector) updateGauges() {
+	rrrs.mtx.RLock()
+	defer rrrs.mtx.RUnlock()
+	nrPaths := 0
+	for _, r := range rrrs.remotes {
+		nrPaths += len(r.Paths)
+	}
+	recordedRemotes.WithLabelValues(rrrs.name).Set(float64(len(rrrs.remotes)))
+	availablePaths.WithLabelValues(rrrs.name).Set(float64(nrPaths))
+}
+
+// policyReason names a policy like the policy types of the configuration file
+func policyReason(policy PathPolicy) string {
+	switch policy.(type) {
+	case MTUPolicy:
+		return "mtu"
+	case LatencyPolicy:
+		return "latency"
+	case BandwidthPolicy:
+		return "bandwidth"
+	case LossPolicy:
+		return "loss"
+	case HopCountPolicy:
+		return "hops"
+	case DisjointPolicy:
+		return "disjoint"
+	case andPolicy:
+		return "and"
+	case orPolicy:
+		return "or"
+	case thenPolicy:
+		return "then"
+	default:
+		return "policy"
+	}
+}
+
+// meteredConn counts the packets and bytes sent per reply path. It chooses the
+// reply paths itself, the same way pan's listening connection does.
+type meteredConn struct {
+	pan.ListenConn
+	rs        pan.ReplySelector
+	name      string
+	closeOnce sync.Once
+	closeErr  error
+	// observed performance per path of the QUIC connections, see feedback.go
+	stats      *PathStats
+	pendingMtx sync.Mutex
+	pending    map[pan.UDPAddr][]pendingPacket
+}
+
+// Close closes the connection only once, as pan would close the reply selector again
+func (c *meteredConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.closeErr = c.ListenConn.Close()
+	})
+	return c.closeErr
+}
+
+func (c *meteredConn) WriteTo(b []byte, dst net.Addr) (int, error) {
+	sdst, ok := dst.(pan.UDPAddr)
+	if !ok {
+		return 0, fmt.Errorf("invalid destination address type %T", dst)
+	}
+	var path *pan.Path
+	pathLabel := "local"
+	if local, ok := c.LocalAddr().(pan.UDPAddr); !ok || local.IA != sdst.IA {
+		path = c.rs.Path(sdst)
+		if path == nil {
+			return 0, fmt.Errorf("no path to %s", sdst.IA)
+		}
+		pathLabel = string(path.Fingerprint)
+	}
+	n, err := c.ListenConn.WriteToVia(b, sdst, path)
+	if err != nil {
+		c.bind(sdst, len(b), nil)
+		return n, err
+	}
+	c.bind(sdst, len(b), path)
+	replyPaths.wrote(sdst, path)
+	remoteIA := sdst.IA.String()
+	replyPackets.WithLabelValues(c.name, remoteIA, pathLabel).Inc()
+	replyBytes.WithLabelValues(c.name, remoteIA, pathLabel).Add(float64(n))
+	return n, err
+}
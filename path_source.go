@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/nils-treuheit/scion-cdn/internal/simnet"
+)
+
+// PathSource provides the candidate paths from the local AS to a remote IA.
+// The reply selectors only learn about paths through this interface so that
+// they can be run against a SCION daemon or against scripted path sets.
+type PathSource interface {
+	QueryPaths(ctx context.Context, dst pan.IA) ([]*pan.Path, error)
+}
+
+// HostPathSource queries paths from the local SCION daemon via pan's host context.
+// The host context is only initialized on first use, as pan.Host() terminates
+// the process if no daemon or dispatcher can be reached.
+type HostPathSource struct {
+	once sync.Once
+	hctx *pan.HostContext
+}
+
+func NewHostPathSource() *HostPathSource {
+	return &HostPathSource{}
+}
+
+func (hps *HostPathSource) host() *pan.HostContext {
+	hps.once.Do(func() { hps.hctx = pan.Host() })
+	return hps.hctx
+}
+
+func (hps *HostPathSource) QueryPaths(ctx context.Context, dst pan.IA) ([]*pan.Path, error) {
+	return hps.host().QueryPaths(ctx, dst)
+}
+
+// MemoryPathSource returns scripted path sets per destination IA.
+// It does not need a SCION daemon or dispatcher and is meant for offline tests.
+// It also answers the probes of a PathProber with scripted RTTs.
+type MemoryPathSource struct {
+	mtx   sync.RWMutex
+	paths map[pan.IA][]*pan.Path
+	err   error
+	rtts  map[pan.PathFingerprint]time.Duration
+}
+
+func NewMemoryPathSource() *MemoryPathSource {
+	return &MemoryPathSource{
+		paths: make(map[pan.IA][]*pan.Path),
+		rtts:  make(map[pan.PathFingerprint]time.Duration),
+	}
+}
+
+// SetPaths replaces the paths returned for dst
+func (mps *MemoryPathSource) SetPaths(dst pan.IA, paths []*pan.Path) {
+	mps.mtx.Lock()
+	defer mps.mtx.Unlock()
+	mps.paths[dst] = append([]*pan.Path{}, paths...)
+}
+
+// SetRTT sets the RTT probes over the path measure, a zero RTT makes the probes get lost
+func (mps *MemoryPathSource) SetRTT(pf pan.PathFingerprint, rtt time.Duration) {
+	mps.mtx.Lock()
+	defer mps.mtx.Unlock()
+	mps.rtts[pf] = rtt
+}
+
+// Ping implements Pinger, probes over paths without an RTT get lost
+func (mps *MemoryPathSource) Ping(ctx context.Context, remote pan.UDPAddr, path *pan.Path) (time.Duration, error) {
+	mps.mtx.RLock()
+	defer mps.mtx.RUnlock()
+	rtt, ok := mps.rtts[path.Fingerprint]
+	if !ok || rtt <= 0 {
+		return 0, errProbeLost
+	}
+	return rtt, nil
+}
+
+// SetError makes every following query fail with err until it is reset to nil
+func (mps *MemoryPathSource) SetError(err error) {
+	mps.mtx.Lock()
+	defer mps.mtx.Unlock()
+	mps.err = err
+}
+
+func (mps *MemoryPathSource) QueryPaths(ctx context.Context, dst pan.IA) ([]*pan.Path, error) {
+	mps.mtx.RLock()
+	defer mps.mtx.RUnlock()
+	if mps.err != nil {
+		return nil, mps.err
+	}
+	paths, ok := mps.paths[dst]
+	if !ok || len(paths) == 0 {
+		return nil, fmt.Errorf("%w to %s", pan.ErrNoPath, dst)
+	}
+	// hand out a copy so that filtering and sorting does not reorder the script
+	return append([]*pan.Path{}, paths...), nil
+}
+
+// NewSimPathSource returns the paths of the simulated network from the servers to the clients,
+// probes measure the round trip time of the paths without queueing
+func NewSimPathSource(network *simnet.Network) *MemoryPathSource {
+	mps := NewMemoryPathSource()
+	paths := network.Paths(network.ServerIA(), network.ClientIA())
+	mps.SetPaths(network.ClientIA(), paths)
+	for _, p := range paths {
+		if rtt, ok := network.RTT(p.Fingerprint); ok {
+			// a lossless path without latency still answers probes
+			if rtt == 0 {
+				rtt = time.Microsecond
+			}
+			mps.SetRTT(p.Fingerprint, rtt)
+		}
+	}
+	return mps
+}
+
+// SyntheticPath describes the metadata of a scripted path.
+// Latency and Bandwidth are per hop, i.e. between interface i and i+1.
+type SyntheticPath struct {
+	Interfaces []pan.PathInterface
+	MTU        uint16
+	Latency    []time.Duration
+	Bandwidth  []uint64
+	Expiry     time.Time
+}
+
+// NewSyntheticPath creates a path from src to dst carrying the given metadata.
+// The path has no forwarding information and cannot be used to send packets.
+func NewSyntheticPath(src, dst pan.IA, sp SyntheticPath) *pan.Path {
+	hops := len(sp.Interfaces) - 1
+	if hops < 0 {
+		hops = 0
+	}
+	// pad per hop vectors, a 0-value marks an unannounced hop
+	latency := make([]time.Duration, hops)
+	copy(latency, sp.Latency)
+	bandwidth := make([]uint64, hops)
+	copy(bandwidth, sp.Bandwidth)
+
+	expiry := sp.Expiry
+	if expiry.IsZero() {
+		expiry = time.Now().Add(6 * time.Hour)
+	}
+
+	return &pan.Path{
+		Source:      src,
+		Destination: dst,
+		Metadata: &pan.PathMetadata{
+			Interfaces: append([]pan.PathInterface{}, sp.Interfaces...),
+			MTU:        sp.MTU,
+			Latency:    latency,
+			Bandwidth:  bandwidth,
+		},
+		Fingerprint: pan.PathSequenceFromInterfaces(sp.Interfaces).Fingerprint(),
+		Expiry:      expiry,
+	}
+}
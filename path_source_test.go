@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+var (
+	testLocalIA  = pan.MustParseIA("1-ff00:0:110")
+	testRemoteIA = pan.MustParseIA("1-ff00:0:111")
+)
+
+// testPath creates a synthetic path to testRemoteIA over the interface IDs
+func testPath(ids ...int) *pan.Path {
+	return testPathMTU(1400, ids...)
+}
+
+// testPathMTU creates a synthetic path to testRemoteIA over the interface IDs with the given MTU
+func testPathMTU(mtu uint16, ids ...int) *pan.Path {
+	ifs := make([]pan.PathInterface, len(ids))
+	for i, id := range ids {
+		ia := testLocalIA
+		if i == len(ids)-1 {
+			ia = testRemoteIA
+		}
+		ifs[i] = pan.PathInterface{IA: ia, IfID: pan.IfID(id)}
+	}
+	return NewSyntheticPath(testLocalIA, testRemoteIA, SyntheticPath{Interfaces: ifs, MTU: mtu})
+}
+
+func testRemote(port uint16) pan.UDPAddr {
+	return pan.UDPAddr{IA: testRemoteIA, Port: port}
+}
+
+func TestMemoryPathSource(t *testing.T) {
+	a, b := testPath(1, 2), testPath(3, 4)
+	mps := NewMemoryPathSource()
+	mps.SetPaths(testRemoteIA, []*pan.Path{a, b})
+
+	paths, err := mps.QueryPaths(context.Background(), testRemoteIA)
+	if err != nil || len(paths) != 2 || paths[0] != a || paths[1] != b {
+		t.Fatalf("got %v, %v, expected the scripted paths", paths, err)
+	}
+	// reordering the result does not reorder the script
+	paths[0], paths[1] = paths[1], paths[0]
+	if paths, _ = mps.QueryPaths(context.Background(), testRemoteIA); paths[0] != a {
+		t.Error("query result shares the scripted paths")
+	}
+
+	if _, err := mps.QueryPaths(context.Background(), testLocalIA); !errors.Is(err, pan.ErrNoPath) {
+		t.Errorf("got %v for an IA without paths, expected no path", err)
+	}
+
+	errQuery := errors.New("daemon unreachable")
+	mps.SetError(errQuery)
+	if _, err := mps.QueryPaths(context.Background(), testRemoteIA); !errors.Is(err, errQuery) {
+		t.Errorf("got %v, expected the scripted error", err)
+	}
+	mps.SetError(nil)
+	if _, err := mps.QueryPaths(context.Background(), testRemoteIA); err != nil {
+		t.Errorf("got %v after resetting the error", err)
+	}
+}
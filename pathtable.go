@@ -0,0 +1,289 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/scionproto/scion/scion/showpaths"
+)
+
+/*
+Every path query of a reply selector leaves a decision in the entry of the remote:
+the queried paths, the paths rejected on the way and why, and the showpaths result of
+daemon backed path sources. Together with the final path list and the rotation state
+it is served by the admin API as the path table of the selector.
+*/
+type pathDecision struct {
+	time      time.Time
+	reason    string
+	err       error
+	queried   []*pan.Path
+	rejected  []rejectedPath
+	showpaths *showpaths.Result
+	// the path ID every chosen path was chosen as
+	ids map[pan.PathFingerprint]int
+}
+
+type rejectedPath struct {
+	path   *pan.Path
+	reason string
+}
+
+func newPathDecision(reason string) *pathDecision {
+	return &pathDecision{time: time.Now(), reason: reason}
+}
+
+// reject notes the paths not kept, why names the reason per path, and returns their number
+func (d *pathDecision) reject(paths, kept pan.PathsMRU, why func(p *pan.Path) string) int {
+	keep := make(map[pan.PathFingerprint]struct{}, len(kept))
+	for _, p := range kept {
+		keep[p.Fingerprint] = struct{}{}
+	}
+	n := 0
+	for _, p := range paths {
+		if _, ok := keep[p.Fingerprint]; !ok {
+			d.rejected = append(d.rejected, rejectedPath{path: p, reason: why(p)})
+			n++
+		}
+	}
+	return n
+}
+
+// rejectionReasons names the policy rejecting each path, the policies combined by And
+// and Then are followed down to the one filtering the path out
+func rejectionReasons(policy PathPolicy, paths []*pan.Path) map[pan.PathFingerprint]string {
+	reasons := make(map[pan.PathFingerprint]string)
+	var steps []PathPolicy
+	switch p := policy.(type) {
+	case andPolicy:
+		steps = p
+	case thenPolicy:
+		steps = p
+	default:
+		kept := make(map[pan.PathFingerprint]struct{})
+		for _, path := range policy.Filter(append([]*pan.Path{}, paths...)) {
+			kept[path.Fingerprint] = struct{}{}
+		}
+		for _, path := range paths {
+			if _, ok := kept[path.Fingerprint]; !ok {
+				reasons[path.Fingerprint] = policyReason(policy)
+			}
+		}
+		return reasons
+	}
+	_, then := policy.(thenPolicy)
+	for _, step := range steps {
+		for pf, reason := range rejectionReasons(step, paths) {
+			reasons[pf] = reason
+		}
+		paths = step.Filter(append([]*pan.Path{}, paths...))
+		// Then orders the paths before the next step, e.g. before a greedy disjoint filter
+		if then {
+			step.Sort(paths)
+		}
+	}
+	return reasons
+}
+
+// rejectByPolicy counts the paths to remote filtered out by the policy and notes
+// the policy rejecting each of them in the decision
+func (rrrs *RRReplySelector) rejectByPolicy(remote pan.UDPAddr, d *pathDecision, policy PathPolicy, paths, kept pan.PathsMRU) {
+	if len(kept) == len(paths) {
+		return
+	}
+	reasons := rejectionReasons(policy, paths)
+	n := d.reject(paths, kept, func(p *pan.Path) string {
+		if reason, ok := reasons[p.Fingerprint]; ok {
+			return reason
+		}
+		return policyReason(policy)
+	})
+	if n > 0 {
+		pathRejections.WithLabelValues(rrrs.name, remote.IA.String(), policyReason(policy)).Add(float64(n))
+	}
+}
+
+// SelectorPathTable is the path table of a reply selector in admin API responses
+type SelectorPathTable struct {
+	Name     string            `json:"name"`
+	Selector string            `json:"selector"`
+	Remotes  []RemotePathTable `json:"remotes"`
+}
+
+// RemotePathTable describes the paths of a remote and how they were chosen
+type RemotePathTable struct {
+	Remote    string    `json:"remote"`
+	Seen      time.Time `json:"seen"`
+	Refreshed time.Time `json:"refreshed"`
+	// the last query of the paths, the paths are kept if a refresh fails
+	Query *PathQuery `json:"query,omitempty"`
+	// the paths the replies are sent over, in the order of the rotation
+	Paths []PathInfo `json:"paths"`
+	// position in Paths of the current path of the rotation and the replies sent over it
+	Index     int `json:"index"`
+	Iteration int `json:"iteration"`
+}
+
+// PathQuery is a path query of a remote
+type PathQuery struct {
+	Time time.Time `json:"time"`
+	// record, refresh or pathdown
+	Reason   string         `json:"reason"`
+	Error    string         `json:"error,omitempty"`
+	Queried  []PathInfo     `json:"queried"`
+	Rejected []RejectedPath `json:"rejected"`
+	// paths and their status as seen by scion showpaths, only for daemon backed path sources
+	Showpaths *showpaths.Result `json:"showpaths,omitempty"`
+}
+
+// RejectedPath is a queried path not used for replies, the reason is down, limit,
+// selection or the rejecting policy
+type RejectedPath struct {
+	PathInfo
+	Reason string `json:"reason"`
+}
+
+// PathInfo describes a path by its metadata
+type PathInfo struct {
+	Fingerprint string `json:"fingerprint"`
+	// interfaces along the path as IA#interface ID
+	Interfaces string `json:"interfaces"`
+	Hops       int    `json:"hops"`
+	// sum of the announced latencies, hops without announced latency are counted separately
+	Latency            Duration `json:"latency"`
+	LatencyUnknownHops int      `json:"latency_unknown_hops,omitempty"`
+	// announced bottleneck bandwidth in Kbit/s
+	Bandwidth            uint64    `json:"bandwidth"`
+	BandwidthUnknownHops int       `json:"bandwidth_unknown_hops,omitempty"`
+	MTU                  uint16    `json:"mtu"`
+	Expiry               time.Time `json:"expiry"`
+	// path ID the path was chosen as, the position among the best paths or the selected path ID
+	ID *int `json:"id,omitempty"`
+	// credit of the striping and weighted selectors and plays of the bandit selector
+	Credit *float64 `json:"credit,omitempty"`
+	Plays  *float64 `json:"plays,omitempty"`
+}
+
+func newPathInfo(p *pan.Path) PathInfo {
+	info := PathInfo{
+		Fingerprint: string(p.Fingerprint),
+		Interfaces:  hopSequence(p),
+		Expiry:      p.Expiry,
+	}
+	if pm := p.Metadata; pm != nil {
+		latency, latUnknown := pm.LatencySum()
+		bandwidth, bwUnknown := pm.BandwidthMin()
+		info.Hops = hopCount(pm)
+		info.Latency = Duration(latency)
+		info.LatencyUnknownHops = len(latUnknown)
+		// without any announced bandwidth the minimum stays at its initial value
+		if bandwidth != math.MaxUint64 {
+			info.Bandwidth = bandwidth
+		}
+		info.BandwidthUnknownHops = len(bwUnknown)
+		info.MTU = pm.MTU
+	}
+	return info
+}
+
+func newPathInfos(paths []*pan.Path) []PathInfo {
+	infos := make([]PathInfo, len(paths))
+	for i, p := range paths {
+		infos[i] = newPathInfo(p)
+	}
+	return infos
+}
+
+func (d *pathDecision) query() *PathQuery {
+	q := &PathQuery{
+		Time:      d.time,
+		Reason:    d.reason,
+		Queried:   newPathInfos(d.queried),
+		Rejected:  make([]RejectedPath, len(d.rejected)),
+		Showpaths: d.showpaths,
+	}
+	if d.err != nil {
+		q.Error = d.err.Error()
+	}
+	for i, rp := range d.rejected {
+		q.Rejected[i] = RejectedPath{PathInfo: newPathInfo(rp.path), Reason: rp.reason}
+	}
+	return q
+}
+
+// PathTable returns the path tables of all recorded remotes ordered by remote
+func (rrrs *RRReplySelector) PathTable() []RemotePathTable {
+	rrrs.mtx.RLock()
+	defer rrrs.mtx.RUnlock()
+	tables := make([]RemotePathTable, 0, len(rrrs.remotes))
+	for remote, r := range rrrs.remotes {
+		t := RemotePathTable{
+			Remote:    remote.String(),
+			Seen:      r.Seen,
+			Refreshed: r.refreshed,
+			Paths:     newPathInfos(r.Paths),
+			Iteration: r.itcount,
+		}
+		if len(r.Paths) > 0 && r.idx >= 1 && r.idx <= len(r.Paths) {
+			t.Index = r.idx - 1
+		}
+		if r.decision != nil {
+			t.Query = r.decision.query()
+		}
+		for i, p := range r.Paths {
+			if id, ok := r.ids[p.Fingerprint]; ok {
+				t.Paths[i].ID = &id
+			}
+			if credit, ok := r.credits[p.Fingerprint]; ok {
+				t.Paths[i].Credit = &credit
+			}
+			if plays, ok := r.plays[p.Fingerprint]; ok {
+				t.Paths[i].Plays = &plays
+			}
+		}
+		tables = append(tables, t)
+	}
+	sort.Slice(tables, func(i, j int) bool { return tables[i].Remote < tables[j].Remote })
+	return tables
+}
+
+func (cbrs *CBReplySelector) PathTable() []RemotePathTable {
+	return cbrs.rrrs.PathTable()
+}
+
+func (srs *StrategicReplySelector) PathTable() []RemotePathTable {
+	return srs.cbrs.PathTable()
+}
+
+// pathTabler is implemented by the reply selectors keeping a path table
+type pathTabler interface {
+	PathTable() []RemotePathTable
+}
+
+// pathTables returns the path tables of the active selector, a selector per content class
+// has a table per class selector
+func pathTables(rs pan.ReplySelector) []SelectorPathTable {
+	switch s := rs.(type) {
+	case *SwappableReplySelector:
+		return pathTables(s.Current())
+	case *MuxReplySelector:
+		classes := make([]string, 0, len(s.selectors))
+		for class := range s.selectors {
+			classes = append(classes, string(class))
+		}
+		sort.Strings(classes)
+		var tables []SelectorPathTable
+		for _, class := range classes {
+			tables = append(tables, pathTables(s.selectors[ContentClass(class)])...)
+		}
+		return tables
+	case pathTabler:
+		return []SelectorPathTable{{Name: selectorName(rs), Selector: fmt.Sprintf("%T", rs), Remotes: s.PathTable()}}
+	default:
+		// e.g. pan's default reply selector
+		return []SelectorPathTable{{Name: selectorName(rs), Selector: fmt.Sprintf("%T", rs), Remotes: []RemotePathTable{}}}
+	}
+}
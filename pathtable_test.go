@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+// latencyPath is a transitPath announcing the latency on each of its hops
+func latencyPath(l, in, out, r int, latency time.Duration) *pan.Path {
+	p := transitPath(l, in, out, r)
+	p.Metadata.Latency = []time.Duration{latency, latency, latency}
+	return p
+}
+
+func TestRejectionReasons(t *testing.T) {
+	slow := latencyPath(1, 1, 2, 1, 30*time.Millisecond)
+	// shares the first link with slow
+	fast := latencyPath(1, 1, 3, 2, 10*time.Millisecond)
+	// shares no interface with the others
+	other := latencyPath(2, 4, 5, 3, 20*time.Millisecond)
+	small := NewSyntheticPath(testLocalIA, testRemoteIA, SyntheticPath{Interfaces: other.Metadata.Interfaces, MTU: 1200})
+	small.Fingerprint = "small"
+
+	tests := []struct {
+		name     string
+		policy   PathPolicy
+		paths    []*pan.Path
+		expected map[pan.PathFingerprint]string
+	}{
+		{"single policy", MTUPolicy{Min: 1400}, []*pan.Path{slow, small}, map[pan.PathFingerprint]string{small.Fingerprint: "mtu"}},
+		{"nothing rejected", DisjointPolicy{}, []*pan.Path{slow, other}, map[pan.PathFingerprint]string{}},
+		{
+			name:     "and names the rejecting policy",
+			policy:   And(MTUPolicy{Min: 1400}, DisjointPolicy{}),
+			paths:    []*pan.Path{small, slow, fast, other},
+			expected: map[pan.PathFingerprint]string{small.Fingerprint: "mtu", fast.Fingerprint: "disjoint"},
+		},
+		{
+			// the latency order decides which of the overlapping paths the disjoint policy keeps
+			name:     "then sorts before the next policy",
+			policy:   Then(LatencyPolicy{}, DisjointPolicy{}),
+			paths:    []*pan.Path{slow, fast, other},
+			expected: map[pan.PathFingerprint]string{slow.Fingerprint: "disjoint"},
+		},
+		{
+			name:     "nested then",
+			policy:   And(MTUPolicy{Min: 1400}, Then(LatencyPolicy{}, DisjointPolicy{})),
+			paths:    []*pan.Path{small, slow, fast},
+			expected: map[pan.PathFingerprint]string{small.Fingerprint: "mtu", slow.Fingerprint: "disjoint"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reasons := rejectionReasons(tt.policy, tt.paths)
+			kept := tt.policy.Filter(append([]*pan.Path{}, tt.paths...))
+			if len(reasons)+len(kept) != len(tt.paths) {
+				t.Errorf("%d paths rejected and %d kept of %d", len(reasons), len(kept), len(tt.paths))
+			}
+			if len(reasons) != len(tt.expected) {
+				t.Fatalf("reasons %v, expected %v", reasons, tt.expected)
+			}
+			for pf, reason := range tt.expected {
+				if reasons[pf] != reason {
+					t.Fatalf("reasons %v, expected %v", reasons, tt.expected)
+				}
+			}
+		})
+	}
+}
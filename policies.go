@@ -0,0 +1,336 @@
+package main
+
+import (
+	"sort"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+// PathPolicy decides which paths are viable for a reply selector and in which
+// order they should be used. Paths without metadata never pass a filter.
+type PathPolicy interface {
+	// Filter returns the paths fulfilling the policy, keeping their order
+	Filter(paths []*pan.Path) []*pan.Path
+	// Sort stably orders the paths from most to least preferred
+	Sort(paths []*pan.Path)
+}
+
+// MTUPolicy keeps paths with an MTU of at least Min bytes, smallest MTU first
+type MTUPolicy struct {
+	Min uint16
+}
+
+func (p MTUPolicy) Filter(paths []*pan.Path) []*pan.Path {
+	return filterFunc(paths, func(pm *pan.PathMetadata) bool {
+		return pm.MTU >= p.Min
+	})
+}
+
+func (p MTUPolicy) Sort(paths []*pan.Path) {
+	sort.SliceStable(paths, func(i, j int) bool {
+		return paths[i].Metadata.MTU < paths[j].Metadata.MTU
+	})
+}
+
+// LatencyPolicy keeps paths with a latency of at most Max, lowest latency first.
+// A zero Max accepts every path. The measured latency of a path is used if
+// Measured knows it, the announced latency otherwise.
+type LatencyPolicy struct {
+	Max      time.Duration
+	Measured LatencyEstimator
+}
+
+// LatencyEstimator provides measured one-way latencies of paths, see PathProber
+type LatencyEstimator interface {
+	Latency(pf pan.PathFingerprint) (time.Duration, bool)
+}
+
+func (p LatencyPolicy) Filter(paths []*pan.Path) []*pan.Path {
+	var filtered []*pan.Path
+	for _, path := range filterFunc(paths, func(*pan.PathMetadata) bool { return true }) {
+		lat, measured := p.measured(path)
+		if !measured {
+			lat, _ = path.Metadata.LatencySum()
+		}
+		if p.Max == 0 || lat <= p.Max {
+			filtered = append(filtered, path)
+		}
+	}
+	return filtered
+}
+
+func (p LatencyPolicy) Sort(paths []*pan.Path) {
+	sortStablePartialOrder(paths, func(i, j int) (bool, bool) {
+		return p.lowerLatency(paths[i], paths[j])
+	})
+}
+
+func (p LatencyPolicy) measured(path *pan.Path) (time.Duration, bool) {
+	if p.Measured == nil {
+		return 0, false
+	}
+	return p.Measured.Latency(path.Fingerprint)
+}
+
+// lowerLatency compares measured latencies, or a measured with a fully announced one,
+// and falls back to the partial order of the announced latencies
+func (p LatencyPolicy) lowerLatency(a, b *pan.Path) (bool, bool) {
+	latA, measuredA := p.measured(a)
+	latB, measuredB := p.measured(b)
+	if !measuredA && !measuredB {
+		return a.Metadata.LowerLatency(b.Metadata)
+	}
+	if !measuredA {
+		var unknown pan.PathHopSet
+		if latA, unknown = a.Metadata.LatencySum(); len(unknown) > 0 {
+			return false, false
+		}
+	}
+	if !measuredB {
+		var unknown pan.PathHopSet
+		if latB, unknown = b.Metadata.LatencySum(); len(unknown) > 0 {
+			return false, false
+		}
+	}
+	return latA < latB, true
+}
+
+// LossPolicy keeps paths with a measured loss rate of at most Max, lowest loss first.
+// A zero Max accepts every path. Paths without measurements rank like lossless paths.
+type LossPolicy struct {
+	Max      float64
+	Measured LossEstimator
+}
+
+// LossEstimator provides measured loss rates of paths, see PathStats and PathProber
+type LossEstimator interface {
+	Loss(pf pan.PathFingerprint) (float64, bool)
+}
+
+func (p LossPolicy) Filter(paths []*pan.Path) []*pan.Path {
+	var filtered []*pan.Path
+	for _, path := range filterFunc(paths, func(*pan.PathMetadata) bool { return true }) {
+		if p.Max == 0 || p.loss(path) <= p.Max {
+			filtered = append(filtered, path)
+		}
+	}
+	return filtered
+}
+
+func (p LossPolicy) Sort(paths []*pan.Path) {
+	sort.SliceStable(paths, func(i, j int) bool {
+		return p.loss(paths[i]) < p.loss(paths[j])
+	})
+}
+
+func (p LossPolicy) loss(path *pan.Path) float64 {
+	if p.Measured == nil {
+		return 0
+	}
+	loss, _ := p.Measured.Loss(path.Fingerprint)
+	return loss
+}
+
+// BandwidthPolicy keeps paths with a bottleneck bandwidth of at least Min Kbit/s, highest bandwidth first
+type BandwidthPolicy struct {
+	Min uint64
+}
+
+func (p BandwidthPolicy) Filter(paths []*pan.Path) []*pan.Path {
+	return filterFunc(paths, func(pm *pan.PathMetadata) bool {
+		bw, _ := pm.BandwidthMin()
+		return bw >= p.Min
+	})
+}
+
+func (p BandwidthPolicy) Sort(paths []*pan.Path) {
+	sortStablePartialOrder(paths, func(i, j int) (bool, bool) {
+		return paths[i].Metadata.HigherBandwidth(paths[j].Metadata)
+	})
+}
+
+// HopCountPolicy keeps paths with at most Max inter-AS links, shortest path first.
+// A zero Max accepts every path.
+type HopCountPolicy struct {
+	Max int
+}
+
+func (p HopCountPolicy) Filter(paths []*pan.Path) []*pan.Path {
+	return filterFunc(paths, func(pm *pan.PathMetadata) bool {
+		return p.Max == 0 || hopCount(pm) <= p.Max
+	})
+}
+
+func (p HopCountPolicy) Sort(paths []*pan.Path) {
+	sort.SliceStable(paths, func(i, j int) bool {
+		return hopCount(paths[i].Metadata) < hopCount(paths[j].Metadata)
+	})
+}
+
+// hopCount returns the number of inter-AS links of a path
+func hopCount(pm *pan.PathMetadata) int {
+	return len(pm.Interfaces) / 2
+}
+
+// DisjointPolicy keeps a maximal set of paths that pairwise share at most MaxOverlap
+// inter-AS links, or interfaces if Interfaces is set. Paths are kept greedily in their
+// order, so combine it with Then to prefer e.g. the lowest latency disjoint paths.
+// Rotating over paths that share a bottleneck link gains nothing.
+type DisjointPolicy struct {
+	MaxOverlap int
+	Interfaces bool
+}
+
+func (p DisjointPolicy) Filter(paths []*pan.Path) []*pan.Path {
+	var kept []*pan.Path
+	var keptSets []pan.PathHopSet
+	for _, path := range filterFunc(paths, func(*pan.PathMetadata) bool { return true }) {
+		set := p.elements(path.Metadata)
+		disjoint := true
+		for _, other := range keptSets {
+			if overlap(set, other) > p.MaxOverlap {
+				disjoint = false
+				break
+			}
+		}
+		if disjoint {
+			kept = append(kept, path)
+			keptSets = append(keptSets, set)
+		}
+	}
+	return kept
+}
+
+// Sort keeps the order, the policy only decides which paths are kept
+func (p DisjointPolicy) Sort(paths []*pan.Path) {}
+
+// elements returns the inter-AS links or the interfaces of a path that must not be shared,
+// an interface is represented by a hop from the interface to nowhere
+func (p DisjointPolicy) elements(pm *pan.PathMetadata) pan.PathHopSet {
+	set := make(pan.PathHopSet)
+	if p.Interfaces {
+		for _, pi := range pm.Interfaces {
+			set[pan.PathHop{A: pi}] = struct{}{}
+		}
+		return set
+	}
+	for hop := range hopPath(pm) {
+		// hops within an AS are covered by the links around them
+		if hop.A.IA != hop.B.IA {
+			set[hop] = struct{}{}
+		}
+	}
+	return set
+}
+
+func overlap(a, b pan.PathHopSet) int {
+	n := 0
+	for e := range a {
+		if _, ok := b[e]; ok {
+			n++
+		}
+	}
+	return n
+}
+
+// And keeps paths fulfilling all policies, ordered by the first policy
+func And(policies ...PathPolicy) PathPolicy {
+	return andPolicy(policies)
+}
+
+type andPolicy []PathPolicy
+
+func (p andPolicy) Filter(paths []*pan.Path) []*pan.Path {
+	for _, policy := range p {
+		paths = policy.Filter(paths)
+	}
+	return paths
+}
+
+func (p andPolicy) Sort(paths []*pan.Path) {
+	if len(p) > 0 {
+		p[0].Sort(paths)
+	}
+}
+
+// Or keeps paths fulfilling any of the policies, ordered by the first policy
+func Or(policies ...PathPolicy) PathPolicy {
+	return orPolicy(policies)
+}
+
+type orPolicy []PathPolicy
+
+func (p orPolicy) Filter(paths []*pan.Path) []*pan.Path {
+	accepted := make(map[pan.PathFingerprint]struct{})
+	for _, policy := range p {
+		for _, path := range policy.Filter(append([]*pan.Path{}, paths...)) {
+			accepted[path.Fingerprint] = struct{}{}
+		}
+	}
+	var filtered []*pan.Path
+	for _, path := range paths {
+		if _, ok := accepted[path.Fingerprint]; ok {
+			filtered = append(filtered, path)
+		}
+	}
+	return filtered
+}
+
+func (p orPolicy) Sort(paths []*pan.Path) {
+	if len(p) > 0 {
+		p[0].Sort(paths)
+	}
+}
+
+// Then applies the policies one after another. Each policy filters the result
+// of the previous one and sorts stably, so the last policy decides the order
+// and earlier policies break its ties.
+func Then(policies ...PathPolicy) PathPolicy {
+	return thenPolicy(policies)
+}
+
+type thenPolicy []PathPolicy
+
+func (p thenPolicy) Filter(paths []*pan.Path) []*pan.Path {
+	for _, policy := range p {
+		paths = policy.Filter(paths)
+		policy.Sort(paths)
+	}
+	return paths
+}
+
+func (p thenPolicy) Sort(paths []*pan.Path) {
+	for _, policy := range p {
+		policy.Sort(paths)
+	}
+}
+
+func filterFunc(paths []*pan.Path, keep func(pm *pan.PathMetadata) bool) []*pan.Path {
+	var filtered []*pan.Path
+	for _, path := range paths {
+		if path.Metadata != nil && keep(path.Metadata) {
+			filtered = append(filtered, path)
+		}
+	}
+	return filtered
+}
+
+// sortStablePartialOrder copied from "github.com/netsec-ethz/scion-apps/pkg/pan/policy.go"
+// as the comparisons of latency and bandwidth metadata only define a partial order.
+// The less function returns (less, comparable), see pan.PathMetadata.LowerLatency.
+// NOTE: insertion sort with quadratic complexity, fine for the few paths per remote.
+func sortStablePartialOrder(s []*pan.Path, lessFunc func(i, j int) (bool, bool)) {
+	for i := 1; i < len(s); i++ {
+		k := i
+		for j := k - 1; j >= 0; j-- {
+			less, ok := lessFunc(k, j)
+			if ok && less {
+				s[j], s[k] = s[k], s[j]
+				k = j
+			} else if ok && !less {
+				break
+			}
+		}
+	}
+}
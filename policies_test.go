@@ -0,0 +1,230 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+// metaPath creates a single hop path over the interface IDs a and b with the given metadata,
+// a zero latency or bandwidth is unannounced
+func metaPath(a, b int, mtu uint16, latency time.Duration, bandwidth uint64) *pan.Path {
+	return NewSyntheticPath(testLocalIA, testRemoteIA, SyntheticPath{
+		Interfaces: []pan.PathInterface{{IA: testLocalIA, IfID: pan.IfID(a)}, {IA: testRemoteIA, IfID: pan.IfID(b)}},
+		MTU:        mtu,
+		Latency:    []time.Duration{latency},
+		Bandwidth:  []uint64{bandwidth},
+	})
+}
+
+// expectOrder checks that paths are exactly the expected paths in their order
+func expectOrder(t *testing.T, paths, expected []*pan.Path) {
+	t.Helper()
+	got := make([]pan.PathFingerprint, len(paths))
+	for i, p := range paths {
+		got[i] = p.Fingerprint
+	}
+	want := make([]pan.PathFingerprint, len(expected))
+	for i, p := range expected {
+		want[i] = p.Fingerprint
+	}
+	if len(got) != len(want) {
+		t.Fatalf("paths %v, expected %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("paths %v, expected %v", got, want)
+		}
+	}
+}
+
+func TestPolicyCombinators(t *testing.T) {
+	p1 := metaPath(1, 2, 1400, 10*time.Millisecond, 100)
+	p2 := metaPath(3, 4, 1500, 30*time.Millisecond, 300)
+	p3 := metaPath(5, 6, 1300, 20*time.Millisecond, 200)
+	p4 := metaPath(7, 8, 1500, 5*time.Millisecond, 50)
+	// paths without metadata never pass a filter
+	bare := &pan.Path{Source: testLocalIA, Destination: testRemoteIA, Fingerprint: "bare"}
+
+	tests := []struct {
+		name     string
+		policy   PathPolicy
+		expected []*pan.Path
+	}{
+		{"mtu", MTUPolicy{Min: 1400}, []*pan.Path{p1, p2, p4}},
+		{"latency", LatencyPolicy{Max: 20 * time.Millisecond}, []*pan.Path{p4, p1, p3}},
+		{"bandwidth", BandwidthPolicy{Min: 100}, []*pan.Path{p2, p3, p1}},
+		{"and sorts by the first policy", And(MTUPolicy{Min: 1400}, LatencyPolicy{Max: 20 * time.Millisecond}), []*pan.Path{p1, p4}},
+		{"and in reverse", And(LatencyPolicy{Max: 20 * time.Millisecond}, MTUPolicy{Min: 1400}), []*pan.Path{p4, p1}},
+		{"and rejecting all", And(MTUPolicy{Min: 1500}, BandwidthPolicy{Min: 400}), nil},
+		{"or sorts by the first policy", Or(MTUPolicy{Min: 1500}, LatencyPolicy{Max: 10 * time.Millisecond}), []*pan.Path{p1, p2, p4}},
+		{"or in reverse", Or(LatencyPolicy{Max: 5 * time.Millisecond}, BandwidthPolicy{Min: 300}), []*pan.Path{p4, p2}},
+		{"then breaks ties by earlier policies", Then(BandwidthPolicy{}, MTUPolicy{}), []*pan.Path{p3, p1, p2, p4}},
+		{"then in reverse", Then(MTUPolicy{}, BandwidthPolicy{}), []*pan.Path{p2, p3, p1, p4}},
+		{"then filters by every policy", Then(MTUPolicy{Min: 1400}, LatencyPolicy{Max: 10 * time.Millisecond}), []*pan.Path{p4, p1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paths := []*pan.Path{p1, p2, p3, bare, p4}
+			expectOrder(t, filterPaths(paths, tt.policy), tt.expected)
+		})
+	}
+}
+
+func TestSortStablePartialOrder(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		name string
+		// latency of every path, zero is unannounced and makes a path incomparable
+		latencies []time.Duration
+		// the order of the paths by their index
+		expected []int
+	}{
+		{"sorted", []time.Duration{10 * ms, 20 * ms, 30 * ms}, []int{0, 1, 2}},
+		{"reversed", []time.Duration{30 * ms, 20 * ms, 10 * ms}, []int{2, 1, 0}},
+		{"equal paths keep their order", []time.Duration{10 * ms, 10 * ms, 5 * ms, 10 * ms}, []int{2, 0, 1, 3}},
+		{"incomparable paths keep their position", []time.Duration{30 * ms, 0, 10 * ms}, []int{2, 1, 0}},
+		{"incomparable paths are skipped", []time.Duration{0, 30 * ms, 0, 10 * ms}, []int{0, 3, 2, 1}},
+		{"empty", nil, []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paths := make([]*pan.Path, len(tt.latencies))
+			for i, lat := range tt.latencies {
+				paths[i] = metaPath(2*i+1, 2*i+2, 1400, lat, 0)
+			}
+			sorted := append([]*pan.Path{}, paths...)
+			sortStablePartialOrder(sorted, func(i, j int) (bool, bool) {
+				return sorted[i].Metadata.LowerLatency(sorted[j].Metadata)
+			})
+			expected := make([]*pan.Path, len(tt.expected))
+			for i, idx := range tt.expected {
+				expected[i] = paths[idx]
+			}
+			expectOrder(t, sorted, expected)
+		})
+	}
+}
+
+var testTransitIA = pan.MustParseIA("1-ff00:0:112")
+
+// transitPath creates a path from the local interface l over the transit AS, entered at
+// interface in and left at out, to the remote interface r
+func transitPath(l, in, out, r int) *pan.Path {
+	return NewSyntheticPath(testLocalIA, testRemoteIA, SyntheticPath{
+		Interfaces: []pan.PathInterface{
+			{IA: testLocalIA, IfID: pan.IfID(l)},
+			{IA: testTransitIA, IfID: pan.IfID(in)},
+			{IA: testTransitIA, IfID: pan.IfID(out)},
+			{IA: testRemoteIA, IfID: pan.IfID(r)},
+		},
+		MTU: 1400,
+	})
+}
+
+func TestDisjointPolicy(t *testing.T) {
+	p1 := transitPath(1, 1, 2, 1)
+	// shares the first link with p1
+	p2 := transitPath(1, 1, 3, 2)
+	// shares the last link with p1
+	p3 := transitPath(2, 4, 2, 1)
+	// shares no interface with any other path
+	p4 := transitPath(3, 5, 6, 3)
+	// shares the local interface but no link with p1
+	p5 := transitPath(1, 7, 8, 4)
+	// shares the hop within the transit AS but no link with p1
+	p6 := transitPath(4, 1, 2, 5)
+	// shares both links with p1 under another fingerprint
+	p7 := transitPath(1, 1, 2, 1)
+	p7.Fingerprint = "detour"
+	bare := &pan.Path{Source: testLocalIA, Destination: testRemoteIA, Fingerprint: "bare"}
+
+	tests := []struct {
+		name     string
+		policy   DisjointPolicy
+		paths    []*pan.Path
+		expected []*pan.Path
+	}{
+		{"link disjoint", DisjointPolicy{}, []*pan.Path{p1, p2, p3, p4}, []*pan.Path{p1, p4}},
+		{"greedy in order", DisjointPolicy{}, []*pan.Path{p2, p1, p3, p4}, []*pan.Path{p2, p3, p4}},
+		{"max overlap 1", DisjointPolicy{MaxOverlap: 1}, []*pan.Path{p1, p2, p3, p4, p7}, []*pan.Path{p1, p2, p3, p4}},
+		{"max overlap 2", DisjointPolicy{MaxOverlap: 2}, []*pan.Path{p1, p7}, []*pan.Path{p1, p7}},
+		{"links ignore shared interfaces", DisjointPolicy{}, []*pan.Path{p1, p5}, []*pan.Path{p1, p5}},
+		{"interface disjoint", DisjointPolicy{Interfaces: true}, []*pan.Path{p1, p5, p4}, []*pan.Path{p1, p4}},
+		{"interfaces with max overlap 1", DisjointPolicy{Interfaces: true, MaxOverlap: 1}, []*pan.Path{p1, p5, p6}, []*pan.Path{p1, p5}},
+		{"hops within an AS are ignored", DisjointPolicy{}, []*pan.Path{p1, p6}, []*pan.Path{p1, p6}},
+		{"paths without metadata", DisjointPolicy{}, []*pan.Path{bare, p1}, []*pan.Path{p1}},
+		{"no paths", DisjointPolicy{}, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectOrder(t, tt.policy.Filter(tt.paths), tt.expected)
+		})
+	}
+}
+
+func TestDisjointElements(t *testing.T) {
+	p := transitPath(1, 2, 3, 4)
+	l1 := pan.PathInterface{IA: testLocalIA, IfID: 1}
+	t2 := pan.PathInterface{IA: testTransitIA, IfID: 2}
+	t3 := pan.PathInterface{IA: testTransitIA, IfID: 3}
+	r4 := pan.PathInterface{IA: testRemoteIA, IfID: 4}
+
+	tests := []struct {
+		name     string
+		policy   DisjointPolicy
+		expected []pan.PathHop
+	}{
+		{"links", DisjointPolicy{}, []pan.PathHop{{A: l1, B: t2}, {A: t3, B: r4}}},
+		{"interfaces", DisjointPolicy{Interfaces: true}, []pan.PathHop{{A: l1}, {A: t2}, {A: t3}, {A: r4}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := tt.policy.elements(p.Metadata)
+			if len(set) != len(tt.expected) {
+				t.Fatalf("elements %v, expected %v", set, tt.expected)
+			}
+			for _, e := range tt.expected {
+				if _, ok := set[e]; !ok {
+					t.Fatalf("elements %v, expected %v", set, tt.expected)
+				}
+			}
+		})
+	}
+}
+
+func TestOverlap(t *testing.T) {
+	hop := func(a, b int) pan.PathHop {
+		return pan.PathHop{A: pan.PathInterface{IA: testLocalIA, IfID: pan.IfID(a)}, B: pan.PathInterface{IA: testRemoteIA, IfID: pan.IfID(b)}}
+	}
+	set := func(hops ...pan.PathHop) pan.PathHopSet {
+		s := make(pan.PathHopSet)
+		for _, h := range hops {
+			s[h] = struct{}{}
+		}
+		return s
+	}
+
+	tests := []struct {
+		name     string
+		a, b     pan.PathHopSet
+		expected int
+	}{
+		{"empty", set(), set(hop(1, 2)), 0},
+		{"disjoint", set(hop(1, 2)), set(hop(3, 4)), 0},
+		{"one shared", set(hop(1, 2), hop(3, 4)), set(hop(3, 4), hop(5, 6)), 1},
+		{"all shared", set(hop(1, 2), hop(3, 4)), set(hop(3, 4), hop(1, 2)), 2},
+		{"swapped interfaces", set(hop(1, 2)), set(hop(2, 1)), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if n := overlap(tt.a, tt.b); n != tt.expected {
+				t.Errorf("overlap %d, expected %d", n, tt.expected)
+			}
+			if n := overlap(tt.b, tt.a); n != tt.expected {
+				t.Errorf("reverse overlap %d, expected %d", n, tt.expected)
+			}
+		})
+	}
+}
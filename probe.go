@@ -0,0 +1,370 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/daemon"
+	"github.com/scionproto/scion/pkg/snet"
+	"github.com/scionproto/scion/pkg/sock/reliable"
+	"github.com/scionproto/scion/scion/ping"
+)
+
+const (
+	// the candidate paths of all tracked remotes are probed this often
+	defaultProbeInterval = 10 * time.Second
+	// a probe without reply within this time counts as lost
+	defaultProbeTimeout = 1 * time.Second
+	// weight of a new sample in the moving averages of RTT and loss
+	probeEWMAWeight = 0.25
+	// at most this many probes are in flight at once
+	maxConcurrentProbes = 16
+)
+
+// errProbeLost is returned by pingers if no reply arrived in time
+var errProbeLost = errors.New("probe lost")
+
+// Pinger measures the round trip time to a remote over one path
+type Pinger interface {
+	Ping(ctx context.Context, remote pan.UDPAddr, path *pan.Path) (time.Duration, error)
+}
+
+// PathProber periodically pings the candidate paths of the remotes of a reply selector
+// and keeps a moving average of the RTT and loss per path. Announced latencies are often
+// missing, the measured latencies let latency policies tell these paths apart.
+type PathProber struct {
+	pinger   Pinger
+	interval time.Duration
+	timeout  time.Duration
+	mtx      sync.RWMutex
+	targets  map[pan.UDPAddr][]*pan.Path
+	stats    map[pan.PathFingerprint]*probeStats
+	lifeMtx  sync.Mutex
+	users    int
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+type probeStats struct {
+	rtt  time.Duration
+	loss float64
+	// rtt is only valid once a probe got a reply
+	replied bool
+	seen    time.Time
+}
+
+type probeTarget struct {
+	remote pan.UDPAddr
+	path   *pan.Path
+}
+
+// zero interval and timeout fall back to the defaults
+func NewPathProber(pinger Pinger, interval, timeout time.Duration) *PathProber {
+	if interval <= 0 {
+		interval = defaultProbeInterval
+	}
+	if timeout <= 0 {
+		timeout = defaultProbeTimeout
+	}
+	return &PathProber{
+		pinger:   pinger,
+		interval: interval,
+		timeout:  timeout,
+		targets:  make(map[pan.UDPAddr][]*pan.Path),
+		stats:    make(map[pan.PathFingerprint]*probeStats),
+	}
+}
+
+// pingerFor pings through the path source if it can, e.g. to inject synthetic RTTs,
+// and sends SCMP echo requests otherwise
+func pingerFor(src PathSource) Pinger {
+	if p, ok := src.(Pinger); ok {
+		return p
+	}
+	return NewSCMPPinger()
+}
+
+// Track replaces the paths probed towards remote
+func (pp *PathProber) Track(remote pan.UDPAddr, paths []*pan.Path) {
+	pp.mtx.Lock()
+	defer pp.mtx.Unlock()
+	pp.targets[remote] = append([]*pan.Path{}, paths...)
+}
+
+// Untrack stops probing towards remote
+func (pp *PathProber) Untrack(remote pan.UDPAddr) {
+	pp.mtx.Lock()
+	defer pp.mtx.Unlock()
+	delete(pp.targets, remote)
+}
+
+// Observe feeds the result of a probe over the path into the moving averages
+func (pp *PathProber) Observe(pf pan.PathFingerprint, rtt time.Duration, lost bool) {
+	pp.mtx.Lock()
+	defer pp.mtx.Unlock()
+	s, ok := pp.stats[pf]
+	if !ok {
+		s = &probeStats{}
+		if lost {
+			s.loss = 1
+		}
+		pp.stats[pf] = s
+	} else if lost {
+		s.loss += probeEWMAWeight * (1 - s.loss)
+	} else {
+		s.loss -= probeEWMAWeight * s.loss
+	}
+	if !lost {
+		if s.replied {
+			s.rtt += time.Duration(probeEWMAWeight * float64(rtt-s.rtt))
+		} else {
+			s.rtt = rtt
+			s.replied = true
+		}
+	}
+	s.seen = time.Now()
+	fp := string(pf)
+	if s.replied {
+		pathRTT.WithLabelValues(fp).Set(s.rtt.Seconds())
+	}
+	pathLoss.WithLabelValues(fp).Set(s.loss)
+}
+
+// RTT returns the smoothed round trip time of the path, if any probe got a reply recently
+func (pp *PathProber) RTT(pf pan.PathFingerprint) (time.Duration, bool) {
+	pp.mtx.RLock()
+	defer pp.mtx.RUnlock()
+	s, ok := pp.stats[pf]
+	if !ok || !s.replied || pp.stale(s, time.Now()) {
+		return 0, false
+	}
+	return s.rtt, true
+}
+
+// Latency estimates the one-way latency of the path as half its RTT,
+// comparable to the latency announced in the path metadata
+func (pp *PathProber) Latency(pf pan.PathFingerprint) (time.Duration, bool) {
+	rtt, ok := pp.RTT(pf)
+	return rtt / 2, ok
+}
+
+// Loss returns the smoothed share of lost probes over the path
+func (pp *PathProber) Loss(pf pan.PathFingerprint) (float64, bool) {
+	pp.mtx.RLock()
+	defer pp.mtx.RUnlock()
+	s, ok := pp.stats[pf]
+	if !ok || pp.stale(s, time.Now()) {
+		return 0, false
+	}
+	return s.loss, true
+}
+
+// measurements of paths that are no longer probed expire after a few rounds
+func (pp *PathProber) stale(s *probeStats, now time.Time) bool {
+	return now.Sub(s.seen) > 3*pp.interval
+}
+
+// start runs the prober while at least one selector uses it
+func (pp *PathProber) start() {
+	pp.lifeMtx.Lock()
+	defer pp.lifeMtx.Unlock()
+	pp.users += 1
+	if pp.users > 1 {
+		return
+	}
+	pp.stop = make(chan struct{})
+	pp.done = make(chan struct{})
+	go pp.run(pp.stop, pp.done)
+}
+
+// close stops the prober once the last selector closed, waiting for the probes in flight
+func (pp *PathProber) close() {
+	pp.lifeMtx.Lock()
+	defer pp.lifeMtx.Unlock()
+	if pp.users == 0 {
+		return
+	}
+	pp.users -= 1
+	if pp.users > 0 {
+		return
+	}
+	close(pp.stop)
+	<-pp.done
+}
+
+func (pp *PathProber) run(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	ticker := time.NewTicker(pp.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			pp.probe(ctx)
+			pp.prune(now)
+		}
+	}
+}
+
+// probe pings every tracked path once, paths shared by several remotes are only
+// probed towards one of them
+func (pp *PathProber) probe(ctx context.Context) {
+	pp.mtx.RLock()
+	targets := make(map[pan.PathFingerprint]probeTarget)
+	for remote, paths := range pp.targets {
+		for _, p := range paths {
+			if _, ok := targets[p.Fingerprint]; !ok {
+				targets[p.Fingerprint] = probeTarget{remote: remote, path: p}
+			}
+		}
+	}
+	pp.mtx.RUnlock()
+
+	sem := make(chan struct{}, maxConcurrentProbes)
+	var wg sync.WaitGroup
+	for pf, t := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(pf pan.PathFingerprint, t probeTarget) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			pctx, cancel := context.WithTimeout(ctx, pp.timeout)
+			defer cancel()
+			rtt, err := pp.pinger.Ping(pctx, t.remote, t.path)
+			// a probe that could not be sent tells nothing about the path
+			if err != nil && !errors.Is(err, errProbeLost) {
+				return
+			}
+			if ctx.Err() == nil {
+				pp.Observe(pf, rtt, err != nil)
+			}
+		}(pf, t)
+	}
+	wg.Wait()
+}
+
+// prune forgets the measurements of paths that are no longer probed
+func (pp *PathProber) prune(now time.Time) {
+	pp.mtx.Lock()
+	defer pp.mtx.Unlock()
+	for pf, s := range pp.stats {
+		if pp.stale(s, now) {
+			delete(pp.stats, pf)
+			pathRTT.DeleteLabelValues(string(pf))
+			pathLoss.DeleteLabelValues(string(pf))
+		}
+	}
+}
+
+// SetProber makes the selector probe the candidate paths of its remotes,
+// the selector starts and stops the prober with its listener.
+// Has to be set before the selector is initialized.
+func (rrrs *RRReplySelector) SetProber(pp *PathProber) {
+	rrrs.prober = pp
+}
+
+func (cbrs *CBReplySelector) SetProber(pp *PathProber) {
+	cbrs.rrrs.SetProber(pp)
+}
+
+func (srs *StrategicReplySelector) SetProber(pp *PathProber) {
+	srs.cbrs.rrrs.SetProber(pp)
+}
+
+// SCMPPinger sends SCMP echo requests over the forwarding path of the probed pan path
+// via the dispatcher, the local SCION daemon is only asked for the local IA.
+// Synthetic paths carry no forwarding path and cannot be probed.
+type SCMPPinger struct {
+	once       sync.Once
+	err        error
+	daemon     daemon.Connector
+	dispatcher reliable.Dispatcher
+	local      *snet.UDPAddr
+}
+
+func NewSCMPPinger() *SCMPPinger {
+	return &SCMPPinger{}
+}
+
+func (sp *SCMPPinger) init(ctx context.Context) error {
+	sp.once.Do(func() {
+		address, ok := os.LookupEnv("SCION_DAEMON_ADDRESS")
+		if !ok {
+			address = daemon.DefaultAPIAddress
+		}
+		dispatcher, ok := os.LookupEnv("SCION_DISPATCHER_SOCKET")
+		if !ok {
+			dispatcher = reliable.DefaultDispPath
+		}
+		sp.daemon, sp.err = daemon.NewService(address).Connect(ctx)
+		if sp.err != nil {
+			return
+		}
+		ia, err := sp.daemon.LocalIA(ctx)
+		if err != nil {
+			sp.err = err
+			return
+		}
+		sp.dispatcher = reliable.NewDispatcher(dispatcher)
+		sp.local = &snet.UDPAddr{IA: ia, Host: &net.UDPAddr{IP: pan.Host().HostInLocalAS}}
+	})
+	return sp.err
+}
+
+func (sp *SCMPPinger) Ping(ctx context.Context, remote pan.UDPAddr, path *pan.Path) (time.Duration, error) {
+	if path.ForwardingPath.DataplanePath == nil {
+		return 0, fmt.Errorf("path %s to %s has no forwarding path", path.Fingerprint, remote.IA)
+	}
+	if err := sp.init(ctx); err != nil {
+		return 0, err
+	}
+
+	timeout := defaultProbeTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+	var rtt time.Duration
+	stats, err := ping.Run(ctx, ping.Config{
+		Dispatcher: sp.dispatcher,
+		Local:      sp.local,
+		Remote: &snet.UDPAddr{
+			IA:      addr.IA(remote.IA),
+			Host:    &net.UDPAddr{IP: net.IP(remote.IP.AsSlice())},
+			Path:    path.ForwardingPath.DataplanePath,
+			NextHop: net.UDPAddrFromAddrPort(path.ForwardingPath.Underlay),
+		},
+		Attempts: 1,
+		// the single echo request is sent right away, ping waits this long before timing out
+		Interval: time.Millisecond,
+		Timeout:  timeout,
+		UpdateHandler: func(u ping.Update) {
+			if u.State == ping.Success {
+				rtt = u.RTT
+			}
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+	if stats.Received == 0 || rtt == 0 {
+		return 0, errProbeLost
+	}
+	return rtt, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+func TestSyntheticFingerprint(t *testing.T) {
+	if pf := testPath(1, 2, 3).Fingerprint; pf != "1 2 3" {
+		t.Errorf("fingerprint %q, expected the interface IDs like pan", pf)
+	}
+}
+
+func TestMemoryPathSourcePing(t *testing.T) {
+	mps := NewMemoryPathSource()
+	fast, slow, lost, unknown := testPath(1, 2), testPath(3, 4), testPath(5, 6), testPath(7, 8)
+	mps.SetRTT(fast.Fingerprint, 10*time.Millisecond)
+	mps.SetRTT(slow.Fingerprint, 80*time.Millisecond)
+	mps.SetRTT(lost.Fingerprint, 0)
+
+	tests := []struct {
+		name string
+		path *pan.Path
+		rtt  time.Duration
+		lost bool
+	}{
+		{"fast", fast, 10 * time.Millisecond, false},
+		{"slow", slow, 80 * time.Millisecond, false},
+		{"zero rtt", lost, 0, true},
+		{"no rtt", unknown, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rtt, err := mps.Ping(context.Background(), testRemote(1), tt.path)
+			if tt.lost {
+				if !errors.Is(err, errProbeLost) {
+					t.Errorf("got %v, %v, expected the probe to get lost", rtt, err)
+				}
+				return
+			}
+			if err != nil || rtt != tt.rtt {
+				t.Errorf("got %v, %v, expected %v", rtt, err, tt.rtt)
+			}
+		})
+	}
+}
+
+func TestSCMPPingerSyntheticPath(t *testing.T) {
+	// synthetic paths are rejected before the daemon is connected
+	sp := NewSCMPPinger()
+	if _, err := sp.Ping(context.Background(), testRemote(1), testPath(1, 2)); err == nil {
+		t.Error("synthetic path without forwarding path probed")
+	}
+	if sp.daemon != nil {
+		t.Error("daemon connected for a path that cannot be probed")
+	}
+}
+
+func TestPathProberProbe(t *testing.T) {
+	mps := NewMemoryPathSource()
+	fast, slow, lost := testPath(1, 2), testPath(3, 4), testPath(5, 6)
+	mps.SetRTT(fast.Fingerprint, 10*time.Millisecond)
+	mps.SetRTT(slow.Fingerprint, 80*time.Millisecond)
+
+	pp := NewPathProber(pingerFor(mps), time.Minute, time.Second)
+	pp.Track(testRemote(1), []*pan.Path{fast, slow, lost})
+	pp.probe(context.Background())
+
+	if lat, ok := pp.Latency(fast.Fingerprint); !ok || lat != 5*time.Millisecond {
+		t.Errorf("latency of fast path %v, %v, expected half its RTT", lat, ok)
+	}
+	if lat, ok := pp.Latency(slow.Fingerprint); !ok || lat != 40*time.Millisecond {
+		t.Errorf("latency of slow path %v, %v, expected half its RTT", lat, ok)
+	}
+	if _, ok := pp.Latency(lost.Fingerprint); ok {
+		t.Error("lost path has a latency")
+	}
+	if loss, ok := pp.Loss(lost.Fingerprint); !ok || loss != 1 {
+		t.Errorf("loss of lost path %v, %v, expected 1", loss, ok)
+	}
+
+	// the RTT of a path changes, the average follows
+	mps.SetRTT(fast.Fingerprint, 20*time.Millisecond)
+	pp.probe(context.Background())
+	rtt, _ := pp.RTT(fast.Fingerprint)
+	if rtt <= 10*time.Millisecond || rtt >= 20*time.Millisecond {
+		t.Errorf("smoothed RTT %v, expected between the old and the new RTT", rtt)
+	}
+
+	// untracked paths are no longer probed
+	pp.Untrack(testRemote(1))
+	pp.probe(context.Background())
+	if rtt2, _ := pp.RTT(fast.Fingerprint); rtt2 != rtt {
+		t.Errorf("untracked path was probed, RTT %v instead of %v", rtt2, rtt)
+	}
+}
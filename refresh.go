@@ -0,0 +1,155 @@
+package main
+
+import (
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+const (
+	// recorded paths of a remote are re-queried this often
+	defaultRefreshInterval = 5 * time.Minute
+	// paths are re-queried this long before the first of them expires
+	pathExpiryMargin = 1 * time.Minute
+	// the refresher checks for due remotes at most this often
+	refreshCheckPeriod = 10 * time.Second
+)
+
+// SetRefreshInterval sets how often the paths of every recorded remote are re-queried.
+// Zero disables the periodic refresh, paths are still re-queried before they expire.
+// Has to be set before the selector is initialized.
+func (rrrs *RRReplySelector) SetRefreshInterval(interval time.Duration) {
+	rrrs.refreshInterval = interval
+}
+
+func (cbrs *CBReplySelector) SetRefreshInterval(interval time.Duration) {
+	cbrs.rrrs.SetRefreshInterval(interval)
+}
+
+func (srs *StrategicReplySelector) SetRefreshInterval(interval time.Duration) {
+	srs.cbrs.rrrs.SetRefreshInterval(interval)
+}
+
+// startRefresher runs the refresher while at least one listener uses the selector
+func (rrrs *RRReplySelector) startRefresher() {
+	rrrs.lifeMtx.Lock()
+	defer rrrs.lifeMtx.Unlock()
+	rrrs.users += 1
+	if rrrs.users > 1 {
+		return
+	}
+	rrrs.stop = make(chan struct{})
+	rrrs.done = make(chan struct{})
+	go rrrs.runRefresher(rrrs.stop, rrrs.done)
+}
+
+// stopRefresher stops the refresher once the last listener closed the selector
+func (rrrs *RRReplySelector) stopRefresher() {
+	rrrs.lifeMtx.Lock()
+	defer rrrs.lifeMtx.Unlock()
+	if rrrs.users == 0 {
+		return
+	}
+	rrrs.users -= 1
+	if rrrs.users > 0 {
+		return
+	}
+	close(rrrs.stop)
+	<-rrrs.done
+}
+
+// runRefresher also evicts idle remotes before refreshing the remaining ones
+func (rrrs *RRReplySelector) runRefresher(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	period := refreshCheckPeriod
+	if rrrs.refreshInterval > 0 && rrrs.refreshInterval < period {
+		period = rrrs.refreshInterval
+	}
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			rrrs.evictIdle(now)
+			rrrs.refresh(now)
+			rrrs.updateGauges()
+		}
+	}
+}
+
+// refresh re-queries the paths of all remotes that are due and swaps their path lists.
+// Queries run without holding mtx so that replies are not blocked meanwhile.
+func (rrrs *RRReplySelector) refresh(now time.Time) {
+	rrrs.mtx.RLock()
+	var due []pan.UDPAddr
+	for remote, r := range rrrs.remotes {
+		if r.refreshDue(now, rrrs.refreshInterval) {
+			due = append(due, remote)
+		}
+	}
+	rrrs.mtx.RUnlock()
+
+	for _, remote := range due {
+		paths, d, err := rrrs.queryPaths(remote, "refresh")
+
+		rrrs.mtx.Lock()
+		if r, ok := rrrs.remotes[remote]; ok {
+			r.refreshed = now
+			r.decision = d
+			if err == nil && len(paths) > 0 {
+				r.swap(paths, d.ids)
+			} else {
+				// keep the known paths as long as they are valid
+				r.dropExpired(now)
+			}
+		}
+		rrrs.mtx.Unlock()
+	}
+}
+
+func (r *remoteEntry) refreshDue(now time.Time, interval time.Duration) bool {
+	if interval > 0 && now.Sub(r.refreshed) >= interval {
+		return true
+	}
+	for _, p := range r.Paths {
+		if p.Expiry.Sub(now) < pathExpiryMargin {
+			return true
+		}
+	}
+	return false
+}
+
+// swap replaces the paths of the remote and the path IDs they were chosen as and
+// continues the rotation on the current path if it is still part of the new list
+func (r *remoteEntry) swap(paths pan.PathsMRU, ids map[pan.PathFingerprint]int) {
+	var cur pan.PathFingerprint
+	if r.idx >= 1 && r.idx <= len(r.Paths) {
+		cur = r.Paths[r.idx-1].Fingerprint
+	}
+	r.Paths = paths
+	r.ids = ids
+	for i, p := range paths {
+		if p.Fingerprint == cur {
+			r.idx = i + 1
+			return
+		}
+	}
+	r.idx = 1
+	r.itcount = 0
+}
+
+func (r *remoteEntry) dropExpired(now time.Time) {
+	var valid pan.PathsMRU
+	for _, p := range r.Paths {
+		if p.Expiry.After(now) {
+			valid = append(valid, p)
+		}
+	}
+	if len(valid) != len(r.Paths) {
+		r.swap(valid, r.ids)
+	}
+}
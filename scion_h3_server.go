@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// how often Shutdown checks whether the active requests finished
+const shutdownPollInterval = 50 * time.Millisecond
+
+// SCIONH3Server wraps a http3.Server making it serve HTTP/3 over SCION
+type SCIONH3Server struct {
+	*http3.Server
+	lc ListenerConfig
+	// requests in progress, new requests are refused while draining
+	active   atomic.Int64
+	draining atomic.Bool
+	mtx      sync.Mutex
+	conn     pan.ListenConn
+}
+
+// NewSCIONH3ServerWithConfig returns a HTTP/3 server listening as described by lc,
+// its Shutdown and Close methods also close the reply selector
+func NewSCIONH3ServerWithConfig(lc ListenerConfig, handler http.Handler) *SCIONH3Server {
+	if lc.ReplySelector == nil {
+		lc.ReplySelector = pan.NewDefaultReplySelector()
+	}
+	srv := &SCIONH3Server{lc: lc}
+	srv.Server = &http3.Server{
+		Addr:       lc.Addr,
+		Handler:    srv.track(handler),
+		TLSConfig:  lc.tlsConfig(),
+		QuicConfig: lc.QUICConfig,
+	}
+	return srv
+}
+
+// ListenAndServe listens for QUIC connections on the SCION address of the
+// ListenerConfig and serves HTTP/3 on them
+func (srv *SCIONH3Server) ListenAndServe() error {
+	if srv.lc.Listener != nil {
+		return errors.New("HTTP/3 servers cannot serve a net.Listener")
+	}
+	conn, err := listenSCION(srv.lc)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	srv.mtx.Lock()
+	srv.conn = conn
+	srv.Server.QuicConfig = conn.quicConfig(srv.lc.QUICConfig)
+	srv.mtx.Unlock()
+	return srv.Server.Serve(conn)
+}
+
+// Shutdown refuses new requests, waits for the active ones to finish and closes the server,
+// as the HTTP/3 server of quic-go cannot drain its connections itself yet
+func (srv *SCIONH3Server) Shutdown(ctx context.Context) error {
+	srv.draining.Store(true)
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for srv.active.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			_ = srv.Close()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return srv.Close()
+}
+
+// Close closes the QUIC listener with all its connections and the SCION connection
+func (srv *SCIONH3Server) Close() error {
+	err := srv.Server.Close()
+	srv.mtx.Lock()
+	conn := srv.conn
+	srv.mtx.Unlock()
+	if conn != nil {
+		if cerr := conn.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (srv *SCIONH3Server) track(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.active.Add(1)
+		defer srv.active.Add(-1)
+		if srv.draining.Load() {
+			http.Error(w, "server shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
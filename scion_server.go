@@ -5,108 +5,322 @@ import (
 	"crypto/tls"
 	"net"
 	"net/http"
+	"sync"
 
 	"github.com/netsec-ethz/scion-apps/pkg/pan"
 
 	"github.com/netsec-ethz/scion-apps/pkg/quicutil"
+	"github.com/nils-treuheit/scion-cdn/internal/simnet"
+	"github.com/quic-go/quic-go"
 )
 
 // Server wraps a http.Server making it work with SCION
 type SCIONServer struct {
 	*http.Server
-	rs pan.ReplySelector
+	lc ListenerConfig
+	// SCION listeners served, closed at once by Close
+	mtx       sync.Mutex
+	listeners []*scionListener
 }
 
-// ListenAndServe listens for HTTP connections on the SCION address addr and calls Serve
-// with handler to handle requests
-func ListenAndServeRepSelect(addr string, handler http.Handler, repsel pan.ReplySelector) error {
-	s := &SCIONServer{
+// ListenerConfig describes the listener ListenAndServe and ListenAndServeTLS serve on
+type ListenerConfig struct {
+	// SCION address to listen on, e.g. ":8899"
+	Addr string
+	// ReplySelector chooses the reply paths, defaults to pan's default reply selector
+	ReplySelector pan.ReplySelector
+	// TLSConfig of the QUIC listener, defaults to a self-signed certificate.
+	// The single stream protocol is added to NextProtos if none is set.
+	TLSConfig *tls.Config
+	// QUICConfig of the QUIC listener, optional
+	QUICConfig *quic.Config
+	// PathStats collects the RTT, loss and delivered bytes the QUIC connections
+	// observe per reply path, defaults to DefaultPathStats
+	PathStats *PathStats
+	// Network is a simulated network to listen on instead of SCION, see internal/simnet.
+	// Selectors should query their paths from it with NewSimPathSource.
+	Network *simnet.Network
+	// Listener is served instead of a new SCION listener, e.g. a loopback listener
+	// in tests without a SCION dispatcher. The other fields are ignored then.
+	// Not supported by HTTP/3 servers.
+	Listener net.Listener
+	// Protocol served on top of QUIC, defaults to ProtoSingleStream
+	Protocol Protocol
+}
+
+// Protocol selects how HTTP is carried over the QUIC connections of a server
+type Protocol string
+
+const (
+	// every HTTP/1.1 connection is tunneled over a QUIC stream of its own
+	ProtoSingleStream Protocol = "single-stream"
+	// HTTP/3 multiplexes the parallel requests of a client on streams of one connection
+	ProtoHTTP3 Protocol = "http3"
+)
+
+// NewSCIONServer returns a server for the SCION address addr replying via the paths of repsel,
+// its Shutdown and Close methods also close the reply selector
+func NewSCIONServer(addr string, handler http.Handler, repsel pan.ReplySelector) *SCIONServer {
+	return NewSCIONServerWithConfig(ListenerConfig{Addr: addr, ReplySelector: repsel}, handler)
+}
+
+// NewSCIONServerWithConfig returns a server listening as described by lc
+func NewSCIONServerWithConfig(lc ListenerConfig, handler http.Handler) *SCIONServer {
+	if lc.ReplySelector == nil {
+		lc.ReplySelector = pan.NewDefaultReplySelector()
+	}
+	return &SCIONServer{
 		Server: &http.Server{
-			Addr:    addr,
+			Addr:    lc.Addr,
 			Handler: handler,
-		}, rs: repsel,
+		},
+		lc: lc,
 	}
-	return s.ListenAndServe()
+}
+
+// ListenAndServe listens for HTTP connections on the SCION address addr and calls Serve
+// with handler to handle requests
+func ListenAndServeRepSelect(addr string, handler http.Handler, repsel pan.ReplySelector) error {
+	return NewSCIONServer(addr, handler, repsel).ListenAndServe()
 }
 
 // ListenAndServe listens for HTTPS connections on the SCION address addr and calls Serve
 // with handler to handle requests
 func ListenAndServeTLSRepSelect(addr, certFile, keyFile string, handler http.Handler, repsel pan.ReplySelector) error {
-	s := &SCIONServer{
-		Server: &http.Server{
-			Addr:    addr,
-			Handler: handler,
-		}, rs: repsel,
-	}
-	return s.ListenAndServeTLS(certFile, keyFile)
+	return NewSCIONServer(addr, handler, repsel).ListenAndServeTLS(certFile, keyFile)
 }
 
 // ListenAndServe listens for HTTP connections on the SCION address addr and calls Serve
 // with handler to handle requests
 func ListenAndServe(addr string, handler http.Handler) error {
-	s := &SCIONServer{
-		Server: &http.Server{
-			Addr:    addr,
-			Handler: handler,
-		}, rs: pan.NewDefaultReplySelector(),
-	}
-	return s.ListenAndServe()
+	return NewSCIONServer(addr, handler, pan.NewDefaultReplySelector()).ListenAndServe()
 }
 
 // ListenAndServe listens for HTTPS connections on the SCION address addr and calls Serve
 // with handler to handle requests
 func ListenAndServeTLS(addr, certFile, keyFile string, handler http.Handler) error {
-	s := &SCIONServer{
-		Server: &http.Server{
-			Addr:    addr,
-			Handler: handler,
-		}, rs: pan.NewDefaultReplySelector(),
-	}
-	return s.ListenAndServeTLS(certFile, keyFile)
+	return NewSCIONServer(addr, handler, pan.NewDefaultReplySelector()).ListenAndServeTLS(certFile, keyFile)
 }
 
+// Serve accepts connections on l, e.g. a quicutil.SingleStreamListener wrapping a
+// listener of pan.ListenQUIC. The reply selector of the server is not used, l replies
+// via the paths of the reply selector it has been created with.
 func (srv *SCIONServer) Serve(l net.Listener) error {
-	// Providing a custom listener defeats the purpose of this library.
-	panic("not implemented")
+	return srv.Server.Serve(l)
 }
 
+// ServeTLS accepts connections on l and runs TLS with the given certificate on top of them.
+// QUIC listeners already run TLS, use ListenerConfig.TLSConfig for their certificates instead.
 func (srv *SCIONServer) ServeTLS(l net.Listener, certFile, keyFile string) error {
-	// Providing a custom listener defeats the purpose of this library.
-	panic("not implemented")
+	return srv.Server.ServeTLS(l, certFile, keyFile)
 }
 
 // ListenAndServe listens for QUIC connections on srv.Addr and
 // calls Serve to handle incoming requests
 func (srv *SCIONServer) ListenAndServe() error {
-	listener, err := listen(srv.Addr, srv.rs)
+	listener, err := srv.listen()
 	if err != nil {
 		return err
 	}
 	defer listener.Close()
-	return srv.Server.Serve(listener)
+	return srv.Serve(listener)
 }
 
+// ListenAndServeTLS serves the certificate in the TLS handshake of QUIC instead of the
+// configured TLSConfig, certificate changes are picked up without a restart.
+// A configured Listener is served with TLS on top like http.Server.ServeTLS does.
 func (srv *SCIONServer) ListenAndServeTLS(certFile, keyFile string) error {
-	listener, err := listen(srv.Addr, srv.rs)
+	if srv.lc.Listener != nil {
+		return srv.ServeTLS(srv.lc.Listener, certFile, keyFile)
+	}
+	certs, err := NewCertStoreFromFiles([]string{certFile}, []string{keyFile})
 	if err != nil {
 		return err
 	}
-	defer listener.Close()
-	return srv.Server.ServeTLS(listener, certFile, keyFile)
+	srv.lc.TLSConfig = certs.TLSConfig()
+	return srv.ListenAndServe()
+}
+
+// Close closes the QUIC listeners with all their connections before the HTTP server,
+// whose connections would otherwise wait for the clients to confirm their close.
+// Shutdown drains the connections instead, the QUIC listeners are closed once they are.
+func (srv *SCIONServer) Close() error {
+	srv.mtx.Lock()
+	listeners := srv.listeners
+	srv.mtx.Unlock()
+	var err error
+	for _, l := range listeners {
+		if cerr := l.closeNow(); err == nil {
+			err = cerr
+		}
+	}
+	if cerr := srv.Server.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// listen returns the listener of the ListenerConfig
+func (srv *SCIONServer) listen() (net.Listener, error) {
+	if srv.lc.Listener != nil {
+		return srv.lc.Listener, nil
+	}
+	l, err := listen(srv.lc)
+	if err != nil {
+		return nil, err
+	}
+	srv.mtx.Lock()
+	srv.listeners = append(srv.listeners, l)
+	srv.mtx.Unlock()
+	return l, nil
 }
 
-func listen(addr string, rs pan.ReplySelector) (net.Listener, error) {
-	tlsCfg := &tls.Config{
-		NextProtos:   []string{quicutil.SingleStreamProto},
-		Certificates: quicutil.MustGenerateSelfSignedCert(),
+func listen(lc ListenerConfig) (*scionListener, error) {
+	tlsCfg := lc.tlsConfig()
+	if len(tlsCfg.NextProtos) == 0 {
+		tlsCfg.NextProtos = []string{quicutil.SingleStreamProto}
 	}
-	laddr, err := pan.ParseOptionalIPPort(addr)
+	conn, err := listenSCION(lc)
 	if err != nil {
 		return nil, err
 	}
-	quicListener, err := pan.ListenQUIC(context.Background(), laddr, rs, tlsCfg, nil)
+	quicListener, err := quic.Listen(conn, tlsCfg, conn.quicConfig(lc.QUICConfig))
 	if err != nil {
+		conn.Close()
 		return nil, err
 	}
-	return quicutil.SingleStreamListener{Listener: quicListener}, nil
+	accepting, stop := context.WithCancel(context.Background())
+	return &scionListener{
+		SingleStreamListener: quicutil.SingleStreamListener{Listener: quicListener},
+		conn:                 conn,
+		accepting:            accepting,
+		stop:                 stop,
+	}, nil
+}
+
+// tlsConfig returns a copy of the configured TLS config or one with a self-signed certificate
+func (lc ListenerConfig) tlsConfig() *tls.Config {
+	if lc.TLSConfig != nil {
+		return lc.TLSConfig.Clone()
+	}
+	return &tls.Config{Certificates: quicutil.MustGenerateSelfSignedCert()}
+}
+
+// listenSCION opens the SCION connection QUIC listens on like pan.ListenQUIC does,
+// but meters the replies sent on it. Closing it closes the reply selector.
+func listenSCION(lc ListenerConfig) (*meteredConn, error) {
+	rs := lc.ReplySelector
+	laddr, err := pan.ParseOptionalIPPort(lc.Addr)
+	if err != nil {
+		return nil, err
+	}
+	var conn pan.ListenConn
+	if lc.Network != nil {
+		conn, err = lc.Network.ListenUDP(laddr, rs)
+	} else {
+		conn, err = pan.ListenUDP(context.Background(), laddr, rs)
+	}
+	if err != nil {
+		return nil, err
+	}
+	stats := lc.PathStats
+	if stats == nil {
+		stats = DefaultPathStats
+	}
+	return &meteredConn{ListenConn: conn, rs: rs, name: selectorName(rs), stats: stats}, nil
+}
+
+// scionListener also closes the SCION connection below the QUIC listener,
+// which in turn closes the reply selector. Close only stops accepting, the QUIC
+// listener and SCION connection are kept until the accepted connections are closed,
+// as closing them ends the connections before their replies are delivered.
+// Closing it more than once is a no-op.
+type scionListener struct {
+	quicutil.SingleStreamListener
+	conn pan.ListenConn
+	// canceled by Close to stop Accept
+	accepting context.Context
+	stop      context.CancelFunc
+	mtx       sync.Mutex
+	// accepted connections that are not closed yet
+	active    int
+	closing   bool
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func (l *scionListener) Accept() (net.Conn, error) {
+	session, err := l.Listener.Accept(l.accepting)
+	if err != nil {
+		if l.accepting.Err() != nil {
+			return nil, net.ErrClosed
+		}
+		return nil, err
+	}
+	stream, err := quicutil.NewSingleStream(session)
+	if err != nil {
+		return nil, err
+	}
+	l.mtx.Lock()
+	closing := l.closing
+	if !closing {
+		l.active++
+	}
+	l.mtx.Unlock()
+	if closing {
+		_ = session.CloseWithError(0, "listener closed")
+		return nil, net.ErrClosed
+	}
+	return &trackedConn{SingleStream: stream, l: l}, nil
+}
+
+// Close stops accepting connections and closes the QUIC listener and SCION
+// connection right away if no accepted connection is left, otherwise the last
+// accepted connection closes them
+func (l *scionListener) Close() error {
+	l.stop()
+	l.mtx.Lock()
+	l.closing = true
+	drained := l.active == 0
+	l.mtx.Unlock()
+	if drained {
+		return l.closeNow()
+	}
+	return nil
+}
+
+// closeNow closes the QUIC listener with all its connections and the SCION connection
+func (l *scionListener) closeNow() error {
+	l.stop()
+	l.closeOnce.Do(func() {
+		l.closeErr = l.SingleStreamListener.Close()
+		if err := l.conn.Close(); l.closeErr == nil {
+			l.closeErr = err
+		}
+	})
+	return l.closeErr
+}
+
+// release is called once per accepted connection when it is closed
+func (l *scionListener) release() {
+	l.mtx.Lock()
+	l.active--
+	drained := l.closing && l.active == 0
+	l.mtx.Unlock()
+	if drained {
+		_ = l.closeNow()
+	}
+}
+
+// trackedConn releases its listener when it is closed
+type trackedConn struct {
+	*quicutil.SingleStream
+	l    *scionListener
+	once sync.Once
+}
+
+func (c *trackedConn) Close() error {
+	err := c.SingleStream.Close()
+	c.once.Do(c.l.release)
+	return err
 }
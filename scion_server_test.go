@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsec-ethz/scion-apps/pkg/quicutil"
+	"github.com/nils-treuheit/scion-cdn/internal/simnet"
+)
+
+// closeCounter counts the Close calls of the reply selector it wraps
+type closeCounter struct {
+	pan.ReplySelector
+	closes atomic.Int32
+}
+
+func (c *closeCounter) Close() error {
+	c.closes.Add(1)
+	return c.ReplySelector.Close()
+}
+
+// lingeringConn keeps the socket of a client open once its QUIC connection is closed,
+// as the simulated network drops the packets in flight of closed sockets
+type lingeringConn struct {
+	pan.Conn
+}
+
+func (c lingeringConn) Close() error {
+	return nil
+}
+
+// serveSimulated serves handler on a simulated network and returns a client of the
+// server and the channel receiving the error Serve returned
+func serveSimulated(t *testing.T, handler http.Handler, rs pan.ReplySelector) (*SCIONServer, *http.Client, <-chan error) {
+	t.Helper()
+	network, err := simnet.NewNetwork(&simnet.Topology{
+		ServerIA: "1-ff00:0:110",
+		ClientIA: "1-ff00:0:111",
+		Paths:    []simnet.PathConfig{{Latency: simnet.Duration(time.Millisecond)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewSCIONServerWithConfig(ListenerConfig{Addr: "127.0.0.1:0", ReplySelector: rs, Network: network}, handler)
+	l, err := srv.listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.Serve(l)
+	}()
+
+	remote := l.Addr().(pan.UDPAddr)
+	tlsCfg := &tls.Config{NextProtos: []string{quicutil.SingleStreamProto}, InsecureSkipVerify: true}
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+			session, err := network.DialQUIC(ctx, netip.AddrPort{}, remote, nil, nil, addr, tlsCfg, nil)
+			if err != nil {
+				return nil, err
+			}
+			t.Cleanup(func() { session.Conn.Close() })
+			session.Conn = lingeringConn{session.Conn}
+			return quicutil.NewSingleStream(session)
+		},
+		DisableKeepAlives: true,
+	}}
+	return srv, client, served
+}
+
+// blockingHandler replies with size bytes once release is closed
+func blockingHandler(started chan<- struct{}, release <-chan struct{}, size int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		_, _ = w.Write(bytes.Repeat([]byte("x"), size))
+	})
+}
+
+// fetch returns the size of the body of a GET request, or the error it failed with
+func fetch(client *http.Client) (int, error) {
+	resp, err := client.Get("http://127.0.0.1/")
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return len(body), err
+}
+
+func TestSCIONServerShutdownDrains(t *testing.T) {
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	rs := &closeCounter{ReplySelector: pan.NewDefaultReplySelector()}
+	srv, client, served := serveSimulated(t, blockingHandler(started, release, 100000), rs)
+
+	fetched := make(chan error, 1)
+	go func() {
+		n, err := fetch(client)
+		if err == nil && n != 100000 {
+			err = errors.New("reply cut short")
+		}
+		fetched <- err
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- srv.Shutdown(ctx)
+	}()
+	select {
+	case err := <-shutdown:
+		t.Fatalf("shutdown returned %v before the active request finished", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if n := rs.closes.Load(); n != 0 {
+		t.Fatal("reply selector closed while a request is active")
+	}
+
+	// the reply of the active request is delivered before the listener is closed
+	close(release)
+	if err := <-fetched; err != nil {
+		t.Errorf("request failed during the shutdown: %v", err)
+	}
+	if err := <-shutdown; err != nil {
+		t.Errorf("shutdown failed: %v", err)
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		t.Errorf("serve returned %v, expected http.ErrServerClosed", err)
+	}
+	if n := rs.closes.Load(); n != 1 {
+		t.Errorf("reply selector closed %d times after draining, expected once", n)
+	}
+}
+
+func TestSCIONServerClose(t *testing.T) {
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	defer close(release)
+	rs := &closeCounter{ReplySelector: pan.NewDefaultReplySelector()}
+	srv, client, served := serveSimulated(t, blockingHandler(started, release, 10), rs)
+
+	go func() {
+		_, _ = fetch(client)
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := srv.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("shutdown returned %v while a request is active, expected the deadline to pass", err)
+	}
+	if n := rs.closes.Load(); n != 0 {
+		t.Fatal("reply selector closed while a request is active")
+	}
+
+	// closing once the deadline passed ends the active connections at once
+	closed := make(chan error, 1)
+	go func() {
+		closed <- srv.Close()
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("close waits for the active connections")
+	}
+	if n := rs.closes.Load(); n != 1 {
+		t.Errorf("reply selector closed %d times, expected once", n)
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		t.Errorf("serve returned %v, expected http.ErrServerClosed", err)
+	}
+}
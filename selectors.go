@@ -1,10 +1,10 @@
 package main
 
 import (
+	"container/list"
 	"context"
 	"net"
 	"os"
-	"sort"
 	"sync"
 	"time"
 
@@ -25,101 +25,130 @@ func hopPath(pm *pan.PathMetadata) pan.PathHopSet {
 }
 
 // works only if paths metaData is present
-func filterPaths(paths pan.PathsMRU, cid int) pan.PathsMRU {
-	var filtered pan.PathsMRU
-
-	switch cid {
-	case 0:
-		var mtus []uint16
-		for idx := 0; idx < len(paths); idx++ {
-			// DEBUG Output:
-			// fmt.Printf("%d. Path's MTU:", idx+1)
-			// fmt.Println(paths[idx].Metadata.MTU)
-			var mtu uint16 = paths[idx].Metadata.MTU
-			if mtu >= 1400 {
-				filtered = append(filtered, paths[idx])
-				mtus = append(mtus, mtu)
-			}
-		}
-		sort.Slice(filtered, func(i, j int) bool {
-			return mtus[i] < mtus[j]
-		})
-	case 1:
-		for idx := 0; idx < len(paths); idx++ {
-			// DEBUG: print non empty latency vectors
-			// if len(paths[idx].Metadata.Latency) > 0 {
-			// 	lats := paths[idx].Metadata.Latency
-			// 	for i := 0; i < len(lats); i++ {
-			// 		if lats[i] != 0 {
-			// 			fmt.Printf("%d. Path's Latencies:", idx+1)
-			// 			fmt.Println(lats)
-			// 			break
-			// 		}
-			// 	}
-			// }
-			lat, _ := paths[idx].Metadata.LatencySum()
-			if lat.Milliseconds() <= 25 {
-				filtered = append(filtered, paths[idx])
-			}
-		}
-		sort.Slice(filtered, func(i, j int) bool {
-			a, b := filtered[i].Metadata.LowerLatency(filtered[j].Metadata)
-			return b && a
-			//return lats[i] < lats[j]
-		})
-	case 2:
-		for idx := 0; idx < len(paths); idx++ {
-			// DEBUG: print non empty bandwidths vectors
-			// if len(paths[idx].Metadata.Bandwidth) > 0 {
-			// 	bws := paths[idx].Metadata.Bandwidth
-			// 	for i := 0; i < len(bws); i++ {
-			// 		if bws[i] != 0 {
-			// 			fmt.Printf("%d. Path's Bandwidths:", idx+1)
-			// 			fmt.Println(bws)
-			// 			break
-			// 		}
-			// 	}
-			// }
-			bw, _ := paths[idx].Metadata.BandwidthMin()
-			if bw >= 100000 {
-				filtered = append(filtered, paths[idx])
-			}
-		}
-		sort.Slice(filtered, func(i, j int) bool {
-			a, b := filtered[i].Metadata.HigherBandwidth(filtered[j].Metadata)
-			return b && a
-			//return bws[i] > bws[j]
-		})
-	case 3:
-		var hopPaths []pan.PathHopSet
-		for idx := 0; idx < len(paths); idx++ {
-			hopPaths = append(hopPaths, hopPath(paths[idx].Metadata))
-			filtered = append(filtered, paths[idx])
-		}
-		sort.Slice(filtered, func(i, j int) bool {
-			return hopPaths[i].SubsetOf(hopPaths[j])
-		})
+// a nil policy keeps all paths in the order they were queried
+func filterPaths(paths pan.PathsMRU, policy PathPolicy) pan.PathsMRU {
+	if policy == nil {
+		return paths
 	}
-	// DEBUG Output:
-	// fmt.Printf("Found %d paths viable paths!\n", len(filtered))
+	filtered := policy.Filter(paths)
+	policy.Sort(filtered)
 	return filtered
 }
 
 // round-robin reply selector
 type RRReplySelector struct {
 	mtx     sync.RWMutex
-	hctx    *pan.HostContext
-	remotes map[pan.UDPAddr]pan.RemoteEntry
-	idx     int
-	itcount int
-	lim     int
-	its     int
+	src     PathSource
+	remotes map[pan.UDPAddr]*remoteEntry
+	// remotes whose first path query is running, closed once it is done
+	querying map[pan.UDPAddr]chan struct{}
+	lim      int
+	its      int
+	// selector label of the metrics, see metrics.go
+	name string
+	// remotes ordered from most to least recently seen, see evict.go
+	lru         *list.List
+	idleTimeout time.Duration
+	maxRemotes  int
+	// choose narrows the queried paths down to the paths used for the rotation
+	// and notes the rejected paths in the decision, see pathtable.go
+	choose    func(remote pan.UDPAddr, paths pan.PathsMRU, d *pathDecision) pan.PathsMRU
+	downMtx   sync.Mutex
+	downPaths map[pan.PathFingerprint]time.Time
+	downIfs   map[pan.PathInterface]time.Time
+	// optional prober measuring the candidate paths of the remotes, see probe.go
+	prober *PathProber
+	// background refresh of the recorded paths, see refresh.go
+	refreshInterval time.Duration
+	lifeMtx         sync.Mutex
+	users           int
+	stop            chan struct{}
+	done            chan struct{}
+}
+
+// paths reported down are excluded from re-queries for this long
+const pathDownTimeout = 30 * time.Second
+
+// remoteEntry extends pan.RemoteEntry by the round-robin state of the remote,
+// such that every remote rotates independently over its own paths
+type remoteEntry struct {
+	pan.RemoteEntry
+	idx       int
+	itcount   int
+	refreshed time.Time
+	lru       *list.Element
+	// credit per path of the striping selector, see striping.go
+	credits map[pan.PathFingerprint]float64
+	// replies per path of the bandit selector, see bandit.go
+	plays map[pan.PathFingerprint]float64
+	// the last path query of the remote, see pathtable.go
+	decision *pathDecision
+	// the path ID every path was chosen as, see weighted.go
+	ids map[pan.PathFingerprint]int
+}
+
+func newRemoteEntry() *remoteEntry {
+	return &remoteEntry{idx: 1, itcount: 0}
+}
+
+// next advances the rotation after its replies over the same path
+func (r *remoteEntry) next(its int) *pan.Path {
+	if r.itcount < its {
+		r.itcount += 1
+	} else {
+		r.itcount = 0
+		r.idx += 1
+	}
+	// the path list might have shrunk since the last reply
+	if r.idx > len(r.Paths) || r.idx < 1 {
+		r.idx = 1
+	}
+	return r.Paths[r.idx-1]
+}
+
+// invalidate removes the paths matching the fingerprint or traversing the interface
+// and keeps the rotation going with the path following the current one
+func (r *remoteEntry) invalidate(pf pan.PathFingerprint, pi pan.PathInterface, its int) bool {
+	cur := r.idx - 1
+	var kept pan.PathsMRU
+	removed := false
+	for i, p := range r.Paths {
+		if p.Fingerprint == pf || isInterfaceOnPath(p, pi) {
+			removed = true
+			if i < cur {
+				r.idx -= 1
+			} else if i == cur {
+				// step back and let the next reply advance onto the successor
+				r.idx -= 1
+				r.itcount = its
+			}
+			continue
+		}
+		kept = append(kept, p)
+	}
+	if removed {
+		r.Paths = kept
+	}
+	return removed
+}
+
+// isInterfaceOnPath inspired by "github.com/netsec-ethz/scion-apps/pkg/pan/path_metadata.go"
+func isInterfaceOnPath(p *pan.Path, pi pan.PathInterface) bool {
+	if p.Metadata == nil {
+		return false
+	}
+	for _, c := range p.Metadata.Interfaces {
+		if c == pi {
+			return true
+		}
+	}
+	return false
 }
 
 // content-based reply selector
 type CBReplySelector struct {
-	rrrs *RRReplySelector
-	cid  int
+	rrrs   *RRReplySelector
+	policy PathPolicy
 }
 
 // used for selected path or path range strategies
@@ -128,72 +157,82 @@ type StrategicReplySelector struct {
 	pathIDs []int
 }
 
-func NewRRReplySelector(nr_rr_paths int, rep_its int) *RRReplySelector {
-	return &RRReplySelector{
-		hctx:    pan.Host(),
-		remotes: make(map[pan.UDPAddr]pan.RemoteEntry),
-		idx:     1,
-		itcount: 0,
-		lim:     nr_rr_paths,
-		its:     rep_its,
+// a nil PathSource falls back to the local SCION daemon
+func newRRReplySelector(src PathSource, lim int, rep_its int) *RRReplySelector {
+	if src == nil {
+		src = NewHostPathSource()
+	}
+	rrrs := &RRReplySelector{
+		src:       src,
+		remotes:   make(map[pan.UDPAddr]*remoteEntry),
+		querying:  make(map[pan.UDPAddr]chan struct{}),
+		lru:       list.New(),
+		lim:       lim,
+		its:       rep_its,
+		name:      "rr",
+		downPaths: make(map[pan.PathFingerprint]time.Time),
+		downIfs:   make(map[pan.PathInterface]time.Time),
+
+		refreshInterval: defaultRefreshInterval,
+		idleTimeout:     defaultIdleTimeout,
+		maxRemotes:      defaultMaxRemotes,
 	}
+	rrrs.choose = rrrs.choosePaths
+	return rrrs
 }
 
-func NewCBReplySelector(content_id int, nr_rr_paths int, rep_its int) *CBReplySelector {
-	return &CBReplySelector{
-		rrrs: &RRReplySelector{
-			remotes: make(map[pan.UDPAddr]pan.RemoteEntry),
-			hctx:    pan.Host(),
-			idx:     1,
-			itcount: 0,
-			lim:     nr_rr_paths,
-			its:     rep_its,
-		},
-		cid: content_id,
+func NewRRReplySelector(src PathSource, nr_rr_paths int, rep_its int) *RRReplySelector {
+	return newRRReplySelector(src, nr_rr_paths, rep_its)
+}
+
+func NewCBReplySelector(src PathSource, policy PathPolicy, nr_rr_paths int, rep_its int) *CBReplySelector {
+	cbrs := &CBReplySelector{
+		rrrs:   newRRReplySelector(src, nr_rr_paths, rep_its),
+		policy: policy,
 	}
+	cbrs.rrrs.choose = cbrs.choosePaths
+	cbrs.rrrs.name = "cb"
+	return cbrs
 }
 
-func NewPathRangeReplySelector(content_id int, prange []int, rep_its int) *StrategicReplySelector {
+func NewPathRangeReplySelector(src PathSource, policy PathPolicy, prange []int, rep_its int) *StrategicReplySelector {
 	var pathRange []int
 	range_start := prange[0]
 	range_end := prange[1]
 	for val := range_start; val < range_end; val++ {
 		pathRange = append(pathRange, val)
 	}
-	return &StrategicReplySelector{
+	return newStrategicReplySelector(src, policy, pathRange, rep_its)
+}
+
+func NewSelectivePathReplySelector(src PathSource, policy PathPolicy, selectedPaths []int, rep_its int) *StrategicReplySelector {
+	return newStrategicReplySelector(src, policy, selectedPaths, rep_its)
+}
+
+func newStrategicReplySelector(src PathSource, policy PathPolicy, pathIDs []int, rep_its int) *StrategicReplySelector {
+	srs := &StrategicReplySelector{
 		cbrs: &CBReplySelector{
-			rrrs: &RRReplySelector{
-				remotes: make(map[pan.UDPAddr]pan.RemoteEntry),
-				hctx:    pan.Host(),
-				idx:     1,
-				itcount: 0,
-				lim:     len(pathRange),
-				its:     rep_its,
-			},
-			cid: content_id,
+			rrrs:   newRRReplySelector(src, len(pathIDs), rep_its),
+			policy: policy,
 		},
-		pathIDs: pathRange,
+		pathIDs: pathIDs,
 	}
+	srs.cbrs.rrrs.choose = srs.choosePaths
+	srs.cbrs.rrrs.name = "strategic"
+	return srs
 }
 
-func NewSelectivePathReplySelector(content_id int, selectedPaths []int, rep_its int) *StrategicReplySelector {
-	return &StrategicReplySelector{
-		cbrs: &CBReplySelector{
-			rrrs: &RRReplySelector{
-				remotes: make(map[pan.UDPAddr]pan.RemoteEntry),
-				hctx:    pan.Host(),
-				idx:     1,
-				itcount: 0,
-				lim:     len(selectedPaths),
-				its:     rep_its,
-			},
-			cid: content_id,
-		},
-		pathIDs: selectedPaths,
+// showpaths needs the SCION daemon, so metadata is only checked for daemon backed path sources
+func checkShowpathsMetadata(src PathSource, remote pan.UDPAddr) *showpaths.Result {
+	if hps, ok := src.(*HostPathSource); ok {
+		if res, err := showpathsMetadata(hps.host().HostInLocalAS, addr.IA(remote.IA)); err == nil {
+			return res
+		}
 	}
+	return nil
 }
 
-func printShowpathsMetadata(local net.IP, remote addr.IA) *showpaths.Result {
+func showpathsMetadata(local net.IP, remote addr.IA) (*showpaths.Result, error) {
 	address, ok := os.LookupEnv("SCION_DAEMON_ADDRESS")
 	if !ok {
 		address = daemon.DefaultAPIAddress
@@ -212,15 +251,7 @@ func printShowpathsMetadata(local net.IP, remote addr.IA) *showpaths.Result {
 		Dispatcher: dispatcher,
 		Epic:       false,
 	}
-	extensivePathsResults, err := showpaths.Run(context.Background(), remote, cfg)
-	if err != nil {
-		// DEBUG Output:
-		// extensivePathsResults.Human(os.Stdout, true, false)
-		return extensivePathsResults
-	}
-	// DEBUG Output:
-	// fmt.Println(err)
-	return nil
+	return showpaths.Run(context.Background(), remote, cfg)
 }
 
 /*
@@ -232,119 +263,143 @@ func (srs *StrategicReplySelector) Record(remote pan.UDPAddr, path *pan.Path) {
 		return
 	}
 
-	srs.cbrs.rrrs.mtx.Lock()
-	defer srs.cbrs.rrrs.mtx.Unlock()
-
-	r, ok := srs.cbrs.rrrs.remotes[remote]
-	if ok && len(r.Paths) > 0 {
-		// DEBUG Output:
-		// fmt.Println("Paths already populated!")
-		return
-	}
+	srs.cbrs.rrrs.record(remote)
+}
 
-	r.Seen = time.Now()
-	// Check Showpaths Meta-Data Fields
-	printShowpathsMetadata(srs.cbrs.rrrs.hctx.HostInLocalAS, addr.IA(remote.IA))
-	// TODO: create better method to populate Meta-Data Fields
-	paths, err := srs.cbrs.rrrs.hctx.QueryPaths(context.Background(), remote.IA)
-	if err != nil {
-		// DEBUG Output:
-		// fmt.Println("ERORR while querying Paths, likely: No Paths found!")
+// for debugging see the path table of the admin API, pathtable.go
+func (cbrs *CBReplySelector) Record(remote pan.UDPAddr, path *pan.Path) {
+	if path == nil {
 		return
 	}
-	// DEBUG Output:
-	// fmt.Printf("Found %d path(s)!\n", len(paths))
-
-	paths = filterPaths(paths, srs.cbrs.cid)
-	// DEBUG Output:
-	// fmt.Printf("Filtered out %d paths.\n", len(paths))
 
-	var newPaths []*pan.Path
-	//for did, idx := range srs.pathIDs {
-	for _, idx := range srs.pathIDs {
-		// DEBUG Output:
-		// fmt.Printf("%d. Path ID is %d ", did, idx)
-		if len(paths) > idx {
-			newPaths = append(newPaths, paths[idx])
-		}
-		// DEBUG Output:
-		// fmt.Printf("and new paths array is now %d elements long.\n", len(newPaths))
-	}
-
-	// DEBUG Output:
-	// fmt.Printf("Inserted %d path(s) into the record!\n", len(newPaths))
-	r.Paths = newPaths
-	srs.cbrs.rrrs.remotes[remote] = r
+	cbrs.rrrs.record(remote)
 }
 
-// for debugging see DEBUG Output implementation above
-func (cbrs *CBReplySelector) Record(remote pan.UDPAddr, path *pan.Path) {
+// The Round-Robin_ReplySelector does not need a content based filter step
+func (s *RRReplySelector) Record(remote pan.UDPAddr, path *pan.Path) {
 	if path == nil {
 		return
 	}
 
-	cbrs.rrrs.mtx.Lock()
-	defer cbrs.rrrs.mtx.Unlock()
+	s.record(remote)
+}
 
-	r, ok := cbrs.rrrs.remotes[remote]
+// record populates the paths of a remote unless they are already known.
+// The query runs without holding mtx, like the refresh in refresh.go, so that
+// replies to other remotes are not blocked meanwhile. Concurrent records of the
+// same remote wait for the first query instead of querying again.
+func (rrrs *RRReplySelector) record(remote pan.UDPAddr) {
+	rrrs.mtx.Lock()
+	r, ok := rrrs.remotes[remote]
+	if ok {
+		rrrs.touch(r, time.Now())
+	}
 	if ok && len(r.Paths) > 0 {
+		rrrs.mtx.Unlock()
 		return
 	}
-
-	r.Seen = time.Now()
-	// Check Showpaths Meta-Data Fields
-	printShowpathsMetadata(cbrs.rrrs.hctx.HostInLocalAS, addr.IA(remote.IA))
-	// TODO: create better method to populate Meta-Data Fields
-	paths, err := cbrs.rrrs.hctx.QueryPaths(context.Background(), remote.IA)
-	if err != nil {
+	if wait, querying := rrrs.querying[remote]; querying {
+		rrrs.mtx.Unlock()
+		<-wait
 		return
 	}
+	done := make(chan struct{})
+	rrrs.querying[remote] = done
+	rrrs.mtx.Unlock()
 
-	paths = filterPaths(paths, cbrs.cid)
+	paths, d, err := rrrs.queryPaths(remote, "record")
 
-	// limit to 5 or 10 best
-	if len(paths) > cbrs.rrrs.lim {
-		paths = paths[:cbrs.rrrs.lim]
+	rrrs.mtx.Lock()
+	defer rrrs.mtx.Unlock()
+	delete(rrrs.querying, remote)
+	close(done)
+	if err != nil {
+		return
 	}
-
-	r.Paths = paths
-	cbrs.rrrs.remotes[remote] = r
+	// the remote may have been evicted meanwhile
+	r, ok = rrrs.remotes[remote]
+	if !ok {
+		r = newRemoteEntry()
+		r.Seen = time.Now()
+		rrrs.insertRemote(remote, r)
+	}
+	r.swap(paths, d.ids)
+	r.decision = d
+	r.refreshed = time.Now()
 }
 
-// The Round-Robin_ReplySelector does not need a content based filter step
-func (s *RRReplySelector) Record(remote pan.UDPAddr, path *pan.Path) {
-	if path == nil {
-		return
+// queryPaths queries the paths to remote without those currently reported down
+// and applies the path choice of the selector, reason labels the query metric.
+// The decision describes the query even if it failed.
+func (rrrs *RRReplySelector) queryPaths(remote pan.UDPAddr, reason string) (pan.PathsMRU, *pathDecision, error) {
+	pathQueries.WithLabelValues(rrrs.name, remote.IA.String(), reason).Inc()
+	d := newPathDecision(reason)
+	paths, err := rrrs.src.QueryPaths(context.Background(), remote.IA)
+	if err != nil {
+		d.err = err
+		return nil, d, err
+	}
+	d.queried = paths
+	var alive pan.PathsMRU
+	for _, p := range paths {
+		if !rrrs.isDown(p) {
+			alive = append(alive, p)
+		}
+	}
+	rrrs.reject(remote, d, "down", paths, alive)
+	if rrrs.prober != nil {
+		rrrs.prober.Track(remote, alive)
 	}
+	return rrrs.choose(remote, alive, d), d, nil
+}
 
-	s.mtx.Lock()
-	defer s.mtx.Unlock()
+// choosePaths limits the paths to the round-robin path limit
+func (rrrs *RRReplySelector) choosePaths(remote pan.UDPAddr, paths pan.PathsMRU, d *pathDecision) pan.PathsMRU {
+	// limit to 5 or 10 best
+	if len(paths) > rrrs.lim {
+		rrrs.reject(remote, d, "limit", paths, paths[:rrrs.lim])
+		paths = paths[:rrrs.lim]
+	}
+	// the best paths are chosen as path IDs 0, 1, ...
+	d.ids = make(map[pan.PathFingerprint]int, len(paths))
+	for i, p := range paths {
+		d.ids[p.Fingerprint] = i
+	}
+	return paths
+}
 
-	r, ok := s.remotes[remote]
-	if ok && len(r.Paths) > 0 {
-		// DEBUG Output:
-		// fmt.Println("Paths already populated!")
-		return
+// choosePaths applies the content filter and limits the result to the round-robin path limit
+func (cbrs *CBReplySelector) choosePaths(remote pan.UDPAddr, paths pan.PathsMRU, d *pathDecision) pan.PathsMRU {
+	// Check Showpaths Meta-Data Fields
+	d.showpaths = checkShowpathsMetadata(cbrs.rrrs.src, remote)
+	// TODO: create better method to populate Meta-Data Fields
+	filtered := filterPaths(paths, cbrs.policy)
+	if cbrs.policy != nil {
+		cbrs.rrrs.rejectByPolicy(remote, d, cbrs.policy, paths, filtered)
 	}
+	return cbrs.rrrs.choosePaths(remote, filtered, d)
+}
 
-	r.Seen = time.Now()
-	paths, err := s.hctx.QueryPaths(context.Background(), remote.IA)
-	if err != nil {
-		// DEBUG Output:
-		// fmt.Println("ERORR while querying Paths, likely: No Paths found!")
-		return
+// choosePaths applies the content filter and picks the selected path IDs of the result
+func (srs *StrategicReplySelector) choosePaths(remote pan.UDPAddr, paths pan.PathsMRU, d *pathDecision) pan.PathsMRU {
+	// Check Showpaths Meta-Data Fields
+	d.showpaths = checkShowpathsMetadata(srs.cbrs.rrrs.src, remote)
+	filtered := filterPaths(paths, srs.cbrs.policy)
+	if srs.cbrs.policy != nil {
+		srs.cbrs.rrrs.rejectByPolicy(remote, d, srs.cbrs.policy, paths, filtered)
 	}
-	// DEBUG Output:
-	// fmt.Printf("Found %d path(s)!\n", len(paths))
+	paths = filtered
 
-	// limit to 5 or 10 best
-	if len(paths) > s.lim {
-		paths = paths[:s.lim]
+	var newPaths pan.PathsMRU
+	d.ids = make(map[pan.PathFingerprint]int, len(srs.pathIDs))
+	for _, idx := range srs.pathIDs {
+		if len(paths) > idx {
+			newPaths = append(newPaths, paths[idx])
+			d.ids[paths[idx].Fingerprint] = idx
+		}
 	}
-	// DEBUG Output:
-	// fmt.Printf("Inserted %d path(s) into the record!\n", len(paths))
-	r.Paths = paths
-	s.remotes[remote] = r
+	srs.cbrs.rrrs.reject(remote, d, "selection", paths, newPaths)
+	return newPaths
 }
 
 /*
@@ -352,26 +407,14 @@ Implement round-robin path selection
 -> this should allow to emulate the default ReplySelector when round-robin path limit is set to 1
 */
 func (rrrs *RRReplySelector) Path(remote pan.UDPAddr) *pan.Path {
-	rrrs.mtx.RLock()
-	defer rrrs.mtx.RUnlock()
+	// choosing a path advances the rotation, hence the write lock
+	rrrs.mtx.Lock()
+	defer rrrs.mtx.Unlock()
 	r, ok := rrrs.remotes[remote]
 	if !ok || len(r.Paths) == 0 {
-		// DEBUG Output:
-		// fmt.Println("No Paths found!")
 		return nil
 	}
-	if rrrs.itcount < rrrs.its {
-		rrrs.itcount += 1
-	} else {
-		rrrs.itcount = 0
-		rrrs.idx += 1
-		if rrrs.idx > len(r.Paths) {
-			rrrs.idx = 1
-		}
-	}
-	// DEBUG Output:
-	// fmt.Printf("Choose %d. path of %d found paths!\n", s.idx, len(r.Paths))
-	return r.Paths[rrrs.idx-1]
+	return r.next(rrrs.its)
 }
 
 /*
@@ -380,15 +423,97 @@ as their function should be the same
 -> side note the SmartReplySelector is a wrapper of the RRReplySelector as such it just calls for the wrapped ReplySelector's behavior
 */
 func (rrrs *RRReplySelector) Initialize(local pan.UDPAddr) {
-	// DEBUG Output:
-	// fmt.Println(len(s.remotes[local].Paths))
+	rrrs.startRefresher()
+	if rrrs.prober != nil {
+		rrrs.prober.start()
+	}
 }
 
-func (rrrs *RRReplySelector) PathDown(pan.PathFingerprint, pan.PathInterface) {
-	// TODO failover.
+// PathDown removes every recorded path matching the fingerprint or traversing
+// the interface. Remotes left without paths are queried again in the background.
+func (rrrs *RRReplySelector) PathDown(pf pan.PathFingerprint, pi pan.PathInterface) {
+	pathDownEvents.WithLabelValues(rrrs.name).Inc()
+	now := time.Now()
+	rrrs.downMtx.Lock()
+	rrrs.downPaths[pf] = now
+	rrrs.downIfs[pi] = now
+	rrrs.pruneDown(now)
+	rrrs.downMtx.Unlock()
+
+	rrrs.mtx.Lock()
+	defer rrrs.mtx.Unlock()
+	for remote, r := range rrrs.remotes {
+		if r.invalidate(pf, pi, rrrs.its) && len(r.Paths) == 0 {
+			go rrrs.requery(remote)
+		}
+	}
+}
+
+// requery repopulates the paths of a known remote whose path list ran empty,
+// the query runs without holding mtx
+func (rrrs *RRReplySelector) requery(remote pan.UDPAddr) {
+	rrrs.mtx.RLock()
+	r, ok := rrrs.remotes[remote]
+	empty := ok && len(r.Paths) == 0
+	rrrs.mtx.RUnlock()
+	if !empty {
+		return
+	}
+	paths, d, err := rrrs.queryPaths(remote, "pathdown")
+
+	rrrs.mtx.Lock()
+	defer rrrs.mtx.Unlock()
+	// the remote may have been evicted or recorded again meanwhile
+	r, ok = rrrs.remotes[remote]
+	if !ok || len(r.Paths) > 0 {
+		return
+	}
+	r.decision = d
+	if err != nil {
+		return
+	}
+	r.swap(paths, d.ids)
+	r.refreshed = time.Now()
+}
+
+// isDown reports whether a path has been reported down within pathDownTimeout
+func (rrrs *RRReplySelector) isDown(p *pan.Path) bool {
+	rrrs.downMtx.Lock()
+	defer rrrs.downMtx.Unlock()
+	now := time.Now()
+	if t, ok := rrrs.downPaths[p.Fingerprint]; ok && now.Sub(t) < pathDownTimeout {
+		return true
+	}
+	if p.Metadata == nil {
+		return false
+	}
+	for _, pi := range p.Metadata.Interfaces {
+		if t, ok := rrrs.downIfs[pi]; ok && now.Sub(t) < pathDownTimeout {
+			return true
+		}
+	}
+	return false
+}
+
+// pruneDown forgets expired down notifications, the caller must hold downMtx
+func (rrrs *RRReplySelector) pruneDown(now time.Time) {
+	for pf, t := range rrrs.downPaths {
+		if now.Sub(t) >= pathDownTimeout {
+			delete(rrrs.downPaths, pf)
+		}
+	}
+	for pi, t := range rrrs.downIfs {
+		if now.Sub(t) >= pathDownTimeout {
+			delete(rrrs.downIfs, pi)
+		}
+	}
 }
 
 func (rrrs *RRReplySelector) Close() error {
+	rrrs.stopRefresher()
+	if rrrs.prober != nil {
+		rrrs.prober.close()
+	}
 	return nil
 }
 
@@ -398,11 +523,10 @@ func (cbrs *CBReplySelector) Initialize(local pan.UDPAddr) {
 
 func (cbrs *CBReplySelector) PathDown(pf pan.PathFingerprint, pi pan.PathInterface) {
 	cbrs.rrrs.PathDown(pf, pi)
-	// TODO failover.
 }
 
 func (cbrs *CBReplySelector) Close() error {
-	return nil
+	return cbrs.rrrs.Close()
 }
 
 func (cbrs *CBReplySelector) Path(remote pan.UDPAddr) *pan.Path {
@@ -415,11 +539,10 @@ func (srs *StrategicReplySelector) Initialize(local pan.UDPAddr) {
 
 func (srs *StrategicReplySelector) PathDown(pf pan.PathFingerprint, pi pan.PathInterface) {
 	srs.cbrs.rrrs.PathDown(pf, pi)
-	// TODO failover.
 }
 
 func (srs *StrategicReplySelector) Close() error {
-	return nil
+	return srs.cbrs.rrrs.Close()
 }
 
 func (srs *StrategicReplySelector) Path(remote pan.UDPAddr) *pan.Path {
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+// testSelector is implemented by the round-robin based reply selectors
+type testSelector interface {
+	pan.ReplySelector
+	RemoteCount() int
+}
+
+// roundRobin returns the round-robin selector wrapped by rs
+func roundRobin(rs testSelector) *RRReplySelector {
+	switch s := rs.(type) {
+	case *CBReplySelector:
+		return s.rrrs
+	case *StrategicReplySelector:
+		return s.cbrs.rrrs
+	}
+	return rs.(*RRReplySelector)
+}
+
+// expectPaths checks the paths of the next replies to remote
+func expectPaths(t *testing.T, rs pan.ReplySelector, remote pan.UDPAddr, expected ...*pan.Path) {
+	t.Helper()
+	for i, e := range expected {
+		if p := rs.Path(remote); p != e {
+			t.Fatalf("reply %d over %v, expected %v", i, fingerprintOf(p), fingerprintOf(e))
+		}
+	}
+}
+
+func fingerprintOf(p *pan.Path) pan.PathFingerprint {
+	if p == nil {
+		return "<nil>"
+	}
+	return p.Fingerprint
+}
+
+func TestReplySelectorRotation(t *testing.T) {
+	big, small, mid := testPathMTU(1500, 1, 2), testPathMTU(1300, 3, 4), testPathMTU(1400, 5, 6)
+
+	tests := []struct {
+		name     string
+		selector func(src PathSource) testSelector
+		// the paths of the first replies
+		expected []*pan.Path
+	}{
+		{
+			name: "rr limits to the first paths",
+			selector: func(src PathSource) testSelector {
+				return NewRRReplySelector(src, 2, 0)
+			},
+			expected: []*pan.Path{small, big, small, big},
+		},
+		{
+			name: "rr repeats every path",
+			selector: func(src PathSource) testSelector {
+				return NewRRReplySelector(src, 3, 1)
+			},
+			expected: []*pan.Path{big, small, small, mid, mid, big, big, small},
+		},
+		{
+			name: "cb filters and sorts by the policy",
+			selector: func(src PathSource) testSelector {
+				return NewCBReplySelector(src, MTUPolicy{Min: 1400}, 5, 0)
+			},
+			expected: []*pan.Path{big, mid, big, mid},
+		},
+		{
+			name: "cb limits the sorted paths",
+			selector: func(src PathSource) testSelector {
+				return NewCBReplySelector(src, MTUPolicy{Min: 1400}, 1, 0)
+			},
+			expected: []*pan.Path{mid, mid, mid},
+		},
+		{
+			name: "selective picks the path IDs in their order",
+			selector: func(src PathSource) testSelector {
+				return NewSelectivePathReplySelector(src, MTUPolicy{Min: 1400}, []int{1, 0}, 0)
+			},
+			expected: []*pan.Path{mid, big, mid, big},
+		},
+		{
+			name: "selective skips missing path IDs",
+			selector: func(src PathSource) testSelector {
+				return NewSelectivePathReplySelector(src, MTUPolicy{Min: 1400}, []int{1, 7}, 0)
+			},
+			expected: []*pan.Path{big, big, big},
+		},
+		{
+			name: "range picks the path IDs from start to end",
+			selector: func(src PathSource) testSelector {
+				return NewPathRangeReplySelector(src, MTUPolicy{Min: 1400}, []int{0, 2}, 0)
+			},
+			expected: []*pan.Path{big, mid, big, mid},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mps := NewMemoryPathSource()
+			mps.SetPaths(testRemoteIA, []*pan.Path{big, small, mid})
+			rs := tt.selector(mps)
+			remote := testRemote(1)
+
+			if p := rs.Path(remote); p != nil {
+				t.Fatalf("reply over %s before the remote was recorded", p.Fingerprint)
+			}
+			rs.Record(remote, big)
+			expectPaths(t, rs, remote, tt.expected...)
+
+			// every remote rotates on its own
+			other := testRemote(2)
+			rs.Record(other, big)
+			expectPaths(t, rs, other, tt.expected[0])
+			if rs.RemoteCount() != 2 {
+				t.Errorf("%d remotes recorded, expected 2", rs.RemoteCount())
+			}
+		})
+	}
+}
+
+func TestReplySelectorPathDown(t *testing.T) {
+	a, b, c, d := testPath(1, 2), testPath(3, 4), testPath(1, 5), testPath(6, 7)
+
+	selectors := []struct {
+		name     string
+		selector func(src PathSource) testSelector
+	}{
+		{"rr", func(src PathSource) testSelector { return NewRRReplySelector(src, 5, 0) }},
+		{"cb", func(src PathSource) testSelector { return NewCBReplySelector(src, MTUPolicy{Min: 1400}, 5, 0) }},
+		{"strategic", func(src PathSource) testSelector {
+			return NewPathRangeReplySelector(src, MTUPolicy{Min: 1400}, []int{0, 5}, 0)
+		}},
+	}
+	for _, s := range selectors {
+		t.Run(s.name+"/fingerprint", func(t *testing.T) {
+			mps := NewMemoryPathSource()
+			mps.SetPaths(testRemoteIA, []*pan.Path{a, b, c})
+			rs := s.selector(mps)
+			remote := testRemote(1)
+			rs.Record(remote, a)
+
+			expectPaths(t, rs, remote, b)
+			// the rotation continues on the successor of the removed path
+			rs.PathDown(b.Fingerprint, pan.PathInterface{})
+			expectPaths(t, rs, remote, c, a, c)
+		})
+
+		t.Run(s.name+"/interface", func(t *testing.T) {
+			mps := NewMemoryPathSource()
+			mps.SetPaths(testRemoteIA, []*pan.Path{a, b, c})
+			rs := s.selector(mps)
+			remote := testRemote(1)
+			rs.Record(remote, a)
+
+			// a and c leave the local AS over interface 1
+			rs.PathDown("", pan.PathInterface{IA: testLocalIA, IfID: 1})
+			expectPaths(t, rs, remote, b, b)
+
+			// remotes recorded later do not get the paths that are down
+			other := testRemote(2)
+			rs.Record(other, a)
+			expectPaths(t, rs, other, b, b)
+		})
+
+		t.Run(s.name+"/requery", func(t *testing.T) {
+			mps := NewMemoryPathSource()
+			mps.SetPaths(testRemoteIA, []*pan.Path{a, b})
+			rs := s.selector(mps)
+			remote := testRemote(1)
+			rs.Record(remote, a)
+
+			// the remote runs out of paths and is queried again in the background
+			mps.SetPaths(testRemoteIA, []*pan.Path{a, b, d})
+			rs.PathDown(a.Fingerprint, pan.PathInterface{})
+			rs.PathDown(b.Fingerprint, pan.PathInterface{})
+			deadline := time.Now().Add(time.Second)
+			p := rs.Path(remote)
+			for p == nil && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+				p = rs.Path(remote)
+			}
+			if p != d {
+				t.Fatalf("reply over %v after the re-query, expected %s", fingerprintOf(p), d.Fingerprint)
+			}
+		})
+	}
+}
+
+func TestReplySelectorQueryError(t *testing.T) {
+	a, b := testPath(1, 2), testPath(3, 4)
+	errQuery := errors.New("daemon unreachable")
+
+	selectors := []struct {
+		name     string
+		selector func(src PathSource) testSelector
+	}{
+		{"rr", func(src PathSource) testSelector { return NewRRReplySelector(src, 5, 0) }},
+		{"cb", func(src PathSource) testSelector { return NewCBReplySelector(src, MTUPolicy{Min: 1400}, 5, 0) }},
+		{"strategic", func(src PathSource) testSelector {
+			return NewSelectivePathReplySelector(src, MTUPolicy{Min: 1400}, []int{0, 1}, 0)
+		}},
+	}
+	for _, s := range selectors {
+		t.Run(s.name, func(t *testing.T) {
+			mps := NewMemoryPathSource()
+			mps.SetPaths(testRemoteIA, []*pan.Path{a, b})
+			mps.SetError(errQuery)
+			rs := s.selector(mps)
+			remote := testRemote(1)
+
+			// a failed query records nothing, the next record queries again
+			rs.Record(remote, a)
+			if p := rs.Path(remote); p != nil || rs.RemoteCount() != 0 {
+				t.Fatalf("reply over %v with %d remotes after a failed query", fingerprintOf(p), rs.RemoteCount())
+			}
+			mps.SetError(nil)
+			rs.Record(remote, a)
+			expectPaths(t, rs, remote, b, a)
+
+			// a failed refresh keeps the known paths
+			mps.SetError(errQuery)
+			roundRobin(rs).refresh(time.Now().Add(defaultRefreshInterval))
+			expectPaths(t, rs, remote, b, a)
+		})
+	}
+}
+
+// gatedSource holds the queries to one IA until the gate is opened
+type gatedSource struct {
+	PathSource
+	ia      pan.IA
+	gate    chan struct{}
+	entered chan struct{}
+	queries atomic.Int32
+}
+
+func (gs *gatedSource) QueryPaths(ctx context.Context, dst pan.IA) ([]*pan.Path, error) {
+	if dst == gs.ia {
+		gs.queries.Add(1)
+		gs.entered <- struct{}{}
+		<-gs.gate
+	}
+	return gs.PathSource.QueryPaths(ctx, dst)
+}
+
+func TestReplySelectorRecordUnlocked(t *testing.T) {
+	a := testPath(1, 2)
+	mps := NewMemoryPathSource()
+	mps.SetPaths(testRemoteIA, []*pan.Path{a})
+	mps.SetPaths(testLocalIA, []*pan.Path{a})
+	gs := &gatedSource{PathSource: mps, ia: testLocalIA, gate: make(chan struct{}), entered: make(chan struct{}, 2)}
+	rs := NewRRReplySelector(gs, 5, 0)
+	remote, slow := testRemote(1), pan.UDPAddr{IA: testLocalIA, Port: 1}
+	rs.Record(remote, a)
+
+	var recorded sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		recorded.Add(1)
+		go func() {
+			defer recorded.Done()
+			rs.Record(slow, a)
+		}()
+	}
+	<-gs.entered
+
+	// replies to other remotes are not blocked by the running query
+	replied := make(chan *pan.Path)
+	go func() { replied <- rs.Path(remote) }()
+	select {
+	case p := <-replied:
+		if p != a {
+			t.Errorf("reply over %v during the query, expected %s", fingerprintOf(p), a.Fingerprint)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reply blocked by the query of another remote")
+	}
+
+	// the concurrent record waits for the first query
+	close(gs.gate)
+	recorded.Wait()
+	if n := gs.queries.Load(); n != 1 {
+		t.Errorf("%d queries for concurrent records of a remote, expected 1", n)
+	}
+	expectPaths(t, rs, slow, a)
+}
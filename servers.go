@@ -10,30 +10,89 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/nils-treuheit/scion-cdn/internal/simnet"
+)
 
-	"github.com/gorilla/handlers"
+// command line flags of the servers, they follow the strategy mode argument
+var (
+	webServPort     = flag.String("webServPort", "80", "The port to serve website on")
+	contentServPort = flag.String("contentServPort", "8181", "The port to serve website-content on")
+	tslServPort     = flag.String("tslServPort", "433", "The tsl port to serve website with tsl certificate on")
+	webDir          = flag.String("webDir", "website", "The directory of static webpage elements to host")
+	fileServPort    = flag.String("fileServPort", "8899", "The port to serve website on")
+	fileDir         = flag.String("fileDir", "stream_files", "The directory of streaming content to host")
+	certFile        = flag.String("cert", "", "Comma separated paths to TLS server certificates, chosen by SNI, enables optional https")
+	keyFile         = flag.String("key", "", "Comma separated paths to the keys of the TLS server certificates")
+	http3Servs      = flag.String("http3", "", "Comma separated names of the servers (file, content, web) serving HTTP/3 instead of single stream QUIC")
+	adminAddr       = flag.String("adminAddr", "127.0.0.1:9090", "The local TCP address to serve the admin API on, empty to disable")
+	topologyFile    = flag.String("topology", "", "A topology file of a simulated network on the loopback interface to serve on instead of SCION")
 )
 
 func main() {
 	var rep_its int = 1000
 	var nr_rr_paths int = 5
 
+	// flags follow the strategy mode argument or the config argument and its file
+	args := os.Args[1:]
+	for len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		args = args[1:]
+	}
+	_ = flag.CommandLine.Parse(args)
+
+	// all selectors query their paths from the local SCION daemon or the simulated network
+	var src PathSource = NewHostPathSource()
+	var network *simnet.Network
+	if *topologyFile != "" {
+		topo, err := simnet.LoadTopology(*topologyFile)
+		if err == nil {
+			network, err = simnet.NewNetwork(topo)
+		}
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		src = NewSimPathSource(network)
+		fmt.Printf("Serve on the simulated network of %s between %s and %s:\n", *topologyFile, network.ServerIA(), network.ClientIA())
+	}
+
+	// path policies of the content-based strategies
+	var mtuPolicy PathPolicy = MTUPolicy{Min: 1400}
+	var latPolicy PathPolicy = LatencyPolicy{Max: 25 * time.Millisecond}
+	var bwPolicy PathPolicy = BandwidthPolicy{Min: 100000}
+	var hopPolicy PathPolicy = HopCountPolicy{}
+	var disjointPolicy PathPolicy = Then(LatencyPolicy{}, DisjointPolicy{})
+
 	// reply selector for video streaming
-	var vsrs pan.ReplySelector = NewSelectivePathReplySelector(1, []int{2, 4, 6, 8}, rep_its)
+	var vsrs pan.ReplySelector = NewSelectivePathReplySelector(src, latPolicy, []int{2, 4, 6, 8}, rep_its)
 
 	// reply selector for content distribution
-	var cdrs pan.ReplySelector = NewSelectivePathReplySelector(1, []int{1, 3, 5, 7}, rep_its)
+	var cdrs pan.ReplySelector = NewSelectivePathReplySelector(src, latPolicy, []int{1, 3, 5, 7}, rep_its)
 
 	// reply selector for general web services
-	var gwrs pan.ReplySelector = NewCBReplySelector(3, 1, rep_its)
+	var gwrs pan.ReplySelector = NewCBReplySelector(src, hopPolicy, 1, rep_its)
+
+	// runs the servers until SIGINT, SIGTERM or SIGHUP and shuts them down gracefully
+	sup := NewSupervisor()
 
 	// cl-arg based strategy selection for benchmarks
-	if len(os.Args) < 2 {
+	if len(os.Args) > 2 && os.Args[1] == "config" {
+		fmt.Printf("Execute configured approach of %s:\n", os.Args[2])
+		cfg, err := LoadConfig(os.Args[2])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if err := startConfiguredServs(sup, cfg, network); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	} else if len(os.Args) < 2 {
 		fmt.Println("Execute selective content-based round robin approach:")
-		startServs(cdrs, vsrs, gwrs)
+		startServs(sup, NewServerRegistry(src), network, cdrs, vsrs, gwrs)
 	} else {
 		command := os.Args[1]
 
@@ -45,61 +104,160 @@ func main() {
 			gwrs = pan.NewDefaultReplySelector()
 		case "sprs":
 			fmt.Println("Execute shortest path reply selector approach:")
-			cdrs = NewCBReplySelector(3, 1, rep_its)
-			vsrs = NewCBReplySelector(3, 1, rep_its)
-			gwrs = NewCBReplySelector(3, 1, rep_its)
+			cdrs = NewCBReplySelector(src, hopPolicy, 1, rep_its)
+			vsrs = NewCBReplySelector(src, hopPolicy, 1, rep_its)
+			gwrs = NewCBReplySelector(src, hopPolicy, 1, rep_its)
 		case "rrrs":
 			fmt.Println("Execute round robin reply selector approach:")
-			cdrs = NewRRReplySelector(nr_rr_paths, rep_its)
-			vsrs = NewRRReplySelector(nr_rr_paths, rep_its)
-			gwrs = NewRRReplySelector(nr_rr_paths, rep_its)
+			cdrs = NewRRReplySelector(src, nr_rr_paths, rep_its)
+			vsrs = NewRRReplySelector(src, nr_rr_paths, rep_its)
+			gwrs = NewRRReplySelector(src, nr_rr_paths, rep_its)
 		case "mturs":
 			fmt.Println("Execute MTU filtered round robin approach:")
-			cdrs = NewCBReplySelector(0, nr_rr_paths, rep_its)
-			vsrs = NewCBReplySelector(0, nr_rr_paths, rep_its)
-			gwrs = NewCBReplySelector(0, nr_rr_paths, rep_its)
+			cdrs = NewCBReplySelector(src, mtuPolicy, nr_rr_paths, rep_its)
+			vsrs = NewCBReplySelector(src, mtuPolicy, nr_rr_paths, rep_its)
+			gwrs = NewCBReplySelector(src, mtuPolicy, nr_rr_paths, rep_its)
 		case "latrs":
 			fmt.Println("Execute latency filtered round robin approach:")
-			cdrs = NewCBReplySelector(1, nr_rr_paths, rep_its)
-			vsrs = NewCBReplySelector(1, nr_rr_paths, rep_its)
-			gwrs = NewCBReplySelector(1, nr_rr_paths, rep_its)
+			cdrs = NewCBReplySelector(src, latPolicy, nr_rr_paths, rep_its)
+			vsrs = NewCBReplySelector(src, latPolicy, nr_rr_paths, rep_its)
+			gwrs = NewCBReplySelector(src, latPolicy, nr_rr_paths, rep_its)
 		case "bwrs":
 			fmt.Println("Execute bandwidth filtered round robin approach:")
-			cdrs = NewCBReplySelector(2, nr_rr_paths, rep_its)
-			vsrs = NewCBReplySelector(2, nr_rr_paths, rep_its)
-			gwrs = NewCBReplySelector(2, nr_rr_paths, rep_its)
+			cdrs = NewCBReplySelector(src, bwPolicy, nr_rr_paths, rep_its)
+			vsrs = NewCBReplySelector(src, bwPolicy, nr_rr_paths, rep_its)
+			gwrs = NewCBReplySelector(src, bwPolicy, nr_rr_paths, rep_its)
+		case "mxrs":
+			fmt.Println("Execute content-aware per request reply selector approach:")
+			newContentMux := func() pan.ReplySelector {
+				mrs, err := NewMuxReplySelector(ClassWeb, map[ContentClass]pan.ReplySelector{
+					ClassStream:  NewSelectivePathReplySelector(src, latPolicy, []int{2, 4, 6, 8}, rep_its),
+					ClassContent: NewSelectivePathReplySelector(src, latPolicy, []int{1, 3, 5, 7}, rep_its),
+					ClassWeb:     NewCBReplySelector(src, hopPolicy, 1, rep_its),
+				})
+				if err != nil {
+					log.Fatalf("%s", err)
+				}
+				return mrs
+			}
+			cdrs = newContentMux()
+			vsrs = newContentMux()
+			gwrs = newContentMux()
+		case "djrs":
+			fmt.Println("Execute link-disjoint round robin approach:")
+			cdrs = NewCBReplySelector(src, disjointPolicy, nr_rr_paths, rep_its)
+			vsrs = NewCBReplySelector(src, disjointPolicy, nr_rr_paths, rep_its)
+			gwrs = NewCBReplySelector(src, disjointPolicy, nr_rr_paths, rep_its)
+		case "plrs":
+			fmt.Println("Execute probed latency filtered round robin approach:")
+			newProbedLatency := func() pan.ReplySelector {
+				pp := NewPathProber(pingerFor(src), 0, 0)
+				cbrs := NewCBReplySelector(src, LatencyPolicy{Max: 25 * time.Millisecond, Measured: pp}, nr_rr_paths, rep_its)
+				cbrs.SetProber(pp)
+				// re-sort the paths by the measured latencies more often
+				cbrs.SetRefreshInterval(time.Minute)
+				return cbrs
+			}
+			cdrs = newProbedLatency()
+			vsrs = newProbedLatency()
+			gwrs = NewCBReplySelector(src, hopPolicy, 1, rep_its)
+		case "fbrs":
+			fmt.Println("Execute observed performance round robin approach:")
+			// prefer the lowest observed latency among the paths losing at most 5% of the packets
+			fbPolicy := Then(LossPolicy{Max: 0.05, Measured: DefaultPathStats}, LatencyPolicy{Measured: DefaultPathStats})
+			newFeedback := func() pan.ReplySelector {
+				cbrs := NewCBReplySelector(src, fbPolicy, nr_rr_paths, rep_its)
+				cbrs.SetRefreshInterval(time.Minute)
+				return cbrs
+			}
+			cdrs = newFeedback()
+			vsrs = newFeedback()
+			gwrs = newFeedback()
+		case "mabrs":
+			fmt.Println("Execute multi-armed bandit reply selector approach:")
+			cdrs = NewBanditReplySelector(src, nil, nr_rr_paths, DefaultPathStats)
+			vsrs = NewBanditReplySelector(src, nil, nr_rr_paths, DefaultPathStats)
+			gwrs = NewBanditReplySelector(src, nil, nr_rr_paths, DefaultPathStats)
+		case "wrrrs":
+			fmt.Println("Execute weighted round robin reply selector approach:")
+			cdrs = NewWeightedReplySelector(src, latPolicy, nr_rr_paths, InverseLatencyWeights{})
+			// mostly path 2, some path 4
+			vsrs = NewWeightedStrategicReplySelector(src, latPolicy, []int{2, 4}, []float64{3, 1})
+			gwrs = NewCBReplySelector(src, hopPolicy, 1, rep_its)
+		case "strrs":
+			fmt.Println("Execute bandwidth proportional multipath striping approach:")
+			cdrs = NewStripingReplySelector(src, BandwidthPolicy{}, nr_rr_paths, DefaultPathStats)
+			vsrs = NewStripingReplySelector(src, BandwidthPolicy{}, nr_rr_paths, DefaultPathStats)
+			gwrs = NewCBReplySelector(src, hopPolicy, 1, rep_its)
 		case "prrs":
 			fmt.Println("Execute simple path range strategy reply selector approach:")
-			vsrs = NewPathRangeReplySelector(1, []int{4, 7}, rep_its)
-			cdrs = NewPathRangeReplySelector(1, []int{1, 4}, rep_its)
-			gwrs = NewCBReplySelector(3, 1, rep_its)
+			vsrs = NewPathRangeReplySelector(src, latPolicy, []int{4, 7}, rep_its)
+			cdrs = NewPathRangeReplySelector(src, latPolicy, []int{1, 4}, rep_its)
+			gwrs = NewCBReplySelector(src, hopPolicy, 1, rep_its)
 		default:
 			fmt.Println("Your ReplySelector Strategy has not been implemented!")
 			return
 		}
-		startServs(cdrs, vsrs, gwrs)
+		startServs(sup, NewServerRegistry(src), network, cdrs, vsrs, gwrs)
+	}
+	if !sup.Wait() {
+		os.Exit(1)
 	}
-	answer := 'c'
-	time.Sleep(3 * time.Duration(time.Second))
-	fmt.Println("Enter any character to terminate session...")
-	fmt.Scanf("\n%c", answer)
-
 }
 
 // relatively simple webserver fileserver topology
 // derived from the SCION-TV project
-func startServs(ivrs pan.ReplySelector, vsrs pan.ReplySelector, grs pan.ReplySelector) {
-	webServPort := flag.String("webServPort", "80", "The port to serve website on")
-	contentServPort := flag.String("contentServPort", "8181", "The port to serve website-content on")
-	tslServPort := flag.String("tslServPort", "433", "The tsl port to serve website with tsl certificate on")
-	webDir := flag.String("webDir", "website", "The directory of static webpage elements to host")
-	fileServPort := flag.String("fileServPort", "8899", "The port to serve website on")
-	fileDir := flag.String("fileDir", "stream_files", "The directory of streaming content to host")
-	flag.Parse()
-
-	go file_server(fileDir, fileServPort, vsrs)          // round robin
-	go content_server(webDir, contentServPort, ivrs)     // path 2-5 -> 10x same
-	go web_server(webDir, tslServPort, webServPort, grs) // shortest path
+// a nil network serves on SCION
+func startServs(sup *Supervisor, reg *ServerRegistry, network *simnet.Network, ivrs pan.ReplySelector, vsrs pan.ReplySelector, grs pan.ReplySelector) {
+	// all servers share the certificates, without any they use a self-signed one
+	certs := NewCertStore()
+	if *certFile != "" || *keyFile != "" {
+		var err error
+		certs, err = NewCertStoreFromFiles(strings.Split(*certFile, ","), strings.Split(*keyFile, ","))
+		if err != nil {
+			log.Fatalf("%s", err)
+		}
+	}
+
+	protos := map[string]Protocol{"file": ProtoSingleStream, "content": ProtoSingleStream, "web": ProtoSingleStream}
+	for _, name := range strings.Split(*http3Servs, ",") {
+		if _, ok := protos[name]; ok {
+			protos[name] = ProtoHTTP3
+		} else if name != "" {
+			log.Fatalf("unknown server %q in -http3, expected file, content or web", name)
+		}
+	}
+
+	// wrap selectors to allow swapping them via the admin API
+	vsrs = reg.Register("file", ":"+*fileServPort, vsrs, nil)
+	ivrs = reg.Register("content", ":"+*contentServPort, ivrs, nil)
+	grs = reg.Register("web", ":"+*webServPort, grs, nil)
+	if *adminAddr != "" {
+		admin_server(sup, *adminAddr, reg)
+	}
+
+	file_server(sup, "file", fileDir, fileServPort, certs, network, protos["file"], nil, vsrs)            // round robin
+	content_server(sup, "content", webDir, contentServPort, certs, network, protos["content"], nil, ivrs) // path 2-5 -> 10x same
+	web_server(sup, "web", webDir, tslServPort, webServPort, certs, network, protos["web"], nil, grs)     // shortest path
+}
+
+// serveSCION runs a single stream or HTTP/3 server for handler as described by lc
+func serveSCION(sup *Supervisor, name string, lc ListenerConfig, handler http.Handler) {
+	if lc.Protocol == ProtoHTTP3 {
+		srv := NewSCIONH3ServerWithConfig(lc, handler)
+		sup.Go(name, srv, srv.ListenAndServe)
+		return
+	}
+	srv := NewSCIONServerWithConfig(lc, handler)
+	sup.Go(name, srv, srv.ListenAndServe)
+}
+
+// addFileRoutes serves the files of directory on the given URL paths
+func addFileRoutes(m *http.ServeMux, directory string, routes map[string]string) {
+	for route, file := range routes {
+		file := directory + "/" + file
+		m.HandleFunc(route, func(w http.ResponseWriter, r *http.Request) { http.ServeFile(w, r, file) })
+	}
 }
 
 // addHeaders will act as middleware to give us CORS support
@@ -110,24 +268,45 @@ func addHeaders(h http.Handler) http.HandlerFunc {
 	}
 }
 
+// contentAware classifies every request for the reply selector if it selects
+// reply paths per content class, other selectors get the handler unchanged
+// the selector is looked up per request as it might be swapped via the admin API
+func contentAware(h http.Handler, rs pan.ReplySelector, routes map[string]ContentClass) http.Handler {
+	classifier := NewContentClassifier(routes)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cur := rs
+		if srs, ok := rs.(*SwappableReplySelector); ok {
+			cur = srs.Current()
+		}
+		mrs, ok := cur.(*MuxReplySelector)
+		if !ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+		ContentSelection(mrs, mrs.classifier(classifier), h).ServeHTTP(w, r)
+	})
+}
+
 /*
 This is a very simple static file server in go
 Navigating to http://localhost:8899 will display the directory file listings.
 */
-func file_server(directory *string, port *string, rs pan.ReplySelector) {
+func file_server(sup *Supervisor, name string, directory *string, port *string, certs *CertStore, network *simnet.Network, proto Protocol, routes map[string]string, rs pan.ReplySelector) {
 	// Sample video from https://www.youtube.com/watch?v=xj2heO4-u-8
 	mux := http.NewServeMux()
 	mux.Handle("/", addHeaders(http.FileServer(http.Dir(*directory))))
+	addFileRoutes(mux, *directory, routes)
+	handler := accessLog(contentAware(mux, rs, nil), rs)
 
-	log.Printf("File-Server serves %s folder's streaming content on HTTP port: %s\n", *directory, *port)
-	log.Fatalf("%s", ListenAndServeRepSelect(":"+*port, mux, rs))
+	log.Printf("File-Server serves %s folder's streaming content on HTTP port: %s (%s)\n", *directory, *port, proto)
+	serveSCION(sup, name, ListenerConfig{Addr: ":" + *port, ReplySelector: rs, TLSConfig: certs.TLSConfig(), Network: network, Protocol: proto}, handler)
 }
 
 /*
 This is a very simple webpage server in go
 Navigating to https://localhost:8181 will display the index.html.
 */
-func content_server(webDir *string, webPort *string, rs pan.ReplySelector) {
+func content_server(sup *Supervisor, name string, webDir *string, webPort *string, certs *CertStore, network *simnet.Network, proto Protocol, routes map[string]string, rs pan.ReplySelector) {
 	pic := *webDir + "/background.png"
 
 	m := http.NewServeMux()
@@ -172,25 +351,28 @@ func content_server(webDir *string, webPort *string, rs pan.ReplySelector) {
 		http.ServeFile(w, r, *webDir+"/SCION_DDoS_Def.mp4")
 		// Sample video from https://www.youtube.com/watch?v=-JeEppbCZTw
 	})
+	addFileRoutes(m, *webDir, routes)
 
-	handler := handlers.LoggingHandler(os.Stdout, m)
-	log.Printf("Content-Server serves webpage content on HTTP port: %s\n", *webPort)
-	log.Fatalf("%s", ListenAndServeRepSelect(":"+*webPort, handler, rs))
+	handler := accessLog(contentAware(m, rs, map[string]ContentClass{
+		"/background.png": ClassContent,
+		"/sample-image":   ClassContent,
+		"/sample-gif":     ClassContent,
+		"/sample-audio":   ClassContent,
+		"/sample-video":   ClassStream,
+	}), rs)
+	log.Printf("Content-Server serves webpage content on HTTP port: %s (%s)\n", *webPort, proto)
+	serveSCION(sup, name, ListenerConfig{Addr: ":" + *webPort, ReplySelector: rs, TLSConfig: certs.TLSConfig(), Network: network, Protocol: proto}, handler)
 }
 
 /*
 This is a very simple webpage server in go
 Navigating to https://localhost:433 or http://localhost:80 will display the index.html.
 */
-func web_server(webDir *string, tslPort *string, webPort *string, rs pan.ReplySelector) {
+func web_server(sup *Supervisor, name string, webDir *string, tslPort *string, webPort *string, certs *CertStore, network *simnet.Network, proto Protocol, routes map[string]string, rs pan.ReplySelector) {
 	webpage := "index.html"
 	website := *webDir + "/" + webpage
 	icon := *webDir + "/favicon.ico"
 
-	certFile := flag.String("cert", "", "Path to TLS server certificate for optional https")
-	keyFile := flag.String("key", "", "Path to TLS server key for optional https")
-	flag.Parse()
-
 	m := http.NewServeMux()
 
 	m.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) { http.ServeFile(w, r, website) })
@@ -232,11 +414,16 @@ func web_server(webDir *string, tslPort *string, webPort *string, rs pan.ReplySe
 		}
 	})
 
-	handler := handlers.LoggingHandler(os.Stdout, m)
-	if *certFile != "" && *keyFile != "" {
-		log.Printf("Web-Server serves %s webpage on HTTPS port: %s\n", webpage, *tslPort)
-		go func() { log.Fatal(ListenAndServeTLSRepSelect(":"+*tslPort, *certFile, *keyFile, handler, rs)) }()
+	addFileRoutes(m, *webDir, routes)
+
+	handler := accessLog(contentAware(m, rs, nil), rs)
+	// QUIC always runs TLS with the shared certificates,
+	// the https port is only kept for clients expecting the web page there
+	tlsCfg := certs.TLSConfig()
+	if *tslPort != "" && tlsCfg != nil {
+		log.Printf("Web-Server serves %s webpage on HTTPS port: %s (%s)\n", webpage, *tslPort, proto)
+		serveSCION(sup, name+"-tls", ListenerConfig{Addr: ":" + *tslPort, ReplySelector: rs, TLSConfig: tlsCfg, Network: network, Protocol: proto}, handler)
 	}
-	log.Printf("Web-Server serves %s webpage on HTTP port: %s\n", webpage, *webPort)
-	log.Fatalf("%s", ListenAndServeRepSelect(":"+*webPort, handler, rs))
+	log.Printf("Web-Server serves %s webpage on HTTP port: %s (%s)\n", webpage, *webPort, proto)
+	serveSCION(sup, name, ListenerConfig{Addr: ":" + *webPort, ReplySelector: rs, TLSConfig: tlsCfg, Network: network, Protocol: proto}, handler)
 }
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+const (
+	// weight of a new throughput sample in the moving average of a path
+	throughputEWMAWeight = 0.3
+	// measurements older than this are ignored in favor of the advertised bandwidth
+	throughputTimeout = 1 * time.Minute
+	// the delivered bytes of the paths are turned into a throughput sample at most this often
+	throughputSampleInterval = 1 * time.Second
+)
+
+// StripingReplySelector spreads the reply packets to a remote over all of its paths
+// proportionally to their bandwidth, so large objects use the aggregate bandwidth of
+// several paths instead of one path at a time. The share of a path follows its
+// measured throughput if known and its advertised bottleneck bandwidth otherwise.
+// The throughput is measured from the bytes the QUIC connections delivered per path,
+// see PathStats. The paths are chosen by the embedded CBReplySelector, only Path differs.
+type StripingReplySelector struct {
+	*CBReplySelector
+	stats      *PathStats
+	measureMtx sync.RWMutex
+	// moving average of the measured throughput per path in Kbit/s
+	measured map[pan.PathFingerprint]throughputEntry
+	// delivered bytes per path at its last sample
+	delivered map[pan.PathFingerprint]deliveredSample
+}
+
+type throughputEntry struct {
+	kbps float64
+	seen time.Time
+}
+
+type deliveredSample struct {
+	bytes uint64
+	at    time.Time
+}
+
+// the policy bounds the paths a remote is striped across to the best nr_paths,
+// a nil PathStats measures the throughput from DefaultPathStats
+func NewStripingReplySelector(src PathSource, policy PathPolicy, nr_paths int, stats *PathStats) *StripingReplySelector {
+	if stats == nil {
+		stats = DefaultPathStats
+	}
+	srs := &StripingReplySelector{
+		CBReplySelector: NewCBReplySelector(src, policy, nr_paths, 0),
+		stats:           stats,
+		measured:        make(map[pan.PathFingerprint]throughputEntry),
+		delivered:       make(map[pan.PathFingerprint]deliveredSample),
+	}
+	srs.rrrs.name = "striping"
+	return srs
+}
+
+// ObserveThroughput feeds a throughput measurement of a path in Kbit/s,
+// the shares of all remotes using the path are rebalanced with the next reply
+func (srs *StripingReplySelector) ObserveThroughput(pf pan.PathFingerprint, kbps float64) {
+	srs.measureMtx.Lock()
+	defer srs.measureMtx.Unlock()
+	srs.observe(pf, kbps, time.Now())
+}
+
+// observe updates the moving average of the path, the caller must hold measureMtx
+func (srs *StripingReplySelector) observe(pf pan.PathFingerprint, kbps float64, now time.Time) {
+	e, ok := srs.measured[pf]
+	if ok && now.Sub(e.seen) < throughputTimeout {
+		e.kbps += throughputEWMAWeight * (kbps - e.kbps)
+	} else {
+		e.kbps = kbps
+	}
+	e.seen = now
+	srs.measured[pf] = e
+}
+
+// sample feeds the throughput every path delivered since its last sample,
+// idle paths keep their last measurement until it times out
+func (srs *StripingReplySelector) sample(paths pan.PathsMRU) {
+	now := time.Now()
+	srs.measureMtx.Lock()
+	defer srs.measureMtx.Unlock()
+	for _, p := range paths {
+		last, known := srs.delivered[p.Fingerprint]
+		elapsed := now.Sub(last.at)
+		if known && elapsed < throughputSampleInterval {
+			continue
+		}
+		perf, ok := srs.stats.Performance(p.Fingerprint)
+		if !ok {
+			continue
+		}
+		srs.delivered[p.Fingerprint] = deliveredSample{bytes: perf.Delivered, at: now}
+		if known && perf.Delivered > last.bytes && elapsed < throughputTimeout {
+			srs.observe(p.Fingerprint, float64(perf.Delivered-last.bytes)*8/1000/elapsed.Seconds(), now)
+		}
+	}
+}
+
+// weights returns the bandwidth share of every path, paths without a measured or
+// advertised bandwidth get the smallest known one, all paths share equally if none is known
+func (srs *StripingReplySelector) weights(paths pan.PathsMRU) []float64 {
+	srs.measureMtx.RLock()
+	defer srs.measureMtx.RUnlock()
+	now := time.Now()
+	weights := make([]float64, len(paths))
+	for i, p := range paths {
+		if e, ok := srs.measured[p.Fingerprint]; ok && e.kbps > 0 && now.Sub(e.seen) < throughputTimeout {
+			weights[i] = e.kbps
+		} else if p.Metadata != nil {
+			// the minimum over no announced hop is math.MaxUint64
+			if bw, _ := p.Metadata.BandwidthMin(); bw != math.MaxUint64 {
+				weights[i] = float64(bw)
+			}
+		}
+	}
+	fillUnknownWeights(weights)
+	return weights
+}
+
+// stripe picks the next path of the remote by smooth weighted round-robin: every path
+// gains credit by its weight, the path with the most credit is chosen and pays the
+// total weight. Over any window every path gets packets in proportion to its weight,
+// interleaved rather than in bursts.
+func stripe(r *remoteEntry, weights []float64) *pan.Path {
+	if len(r.credits) > len(r.Paths) || r.credits == nil {
+		// forget the credit of paths that have been removed
+		credits := make(map[pan.PathFingerprint]float64, len(r.Paths))
+		for _, p := range r.Paths {
+			credits[p.Fingerprint] = r.credits[p.Fingerprint]
+		}
+		r.credits = credits
+	}
+	total := 0.0
+	best := -1
+	for i, p := range r.Paths {
+		total += weights[i]
+		r.credits[p.Fingerprint] += weights[i]
+		if best < 0 || r.credits[p.Fingerprint] > r.credits[r.Paths[best].Fingerprint] {
+			best = i
+		}
+	}
+	chosen := r.Paths[best]
+	r.credits[chosen.Fingerprint] -= total
+	return chosen
+}
+
+func (srs *StripingReplySelector) Path(remote pan.UDPAddr) *pan.Path {
+	rrrs := srs.rrrs
+	rrrs.mtx.Lock()
+	defer rrrs.mtx.Unlock()
+	r, ok := rrrs.remotes[remote]
+	if !ok || len(r.Paths) == 0 {
+		return nil
+	}
+	srs.sample(r.Paths)
+	return stripe(r, srs.weights(r.Paths))
+}
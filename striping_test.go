@@ -0,0 +1,189 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+func TestStripingWeights(t *testing.T) {
+	slow, fast := metaPath(1, 2, 1400, 0, 100), metaPath(3, 4, 1400, 0, 300)
+	unannounced := metaPath(5, 6, 1400, 0, 0)
+	bare := &pan.Path{Source: testLocalIA, Destination: testRemoteIA, Fingerprint: "bare"}
+
+	tests := []struct {
+		name     string
+		paths    pan.PathsMRU
+		measured map[pan.PathFingerprint]throughputEntry
+		expected []float64
+	}{
+		{"advertised bandwidth", pan.PathsMRU{slow, fast}, nil, []float64{100, 300}},
+		{
+			name:     "measured throughput",
+			paths:    pan.PathsMRU{slow, fast},
+			measured: map[pan.PathFingerprint]throughputEntry{slow.Fingerprint: {kbps: 500, seen: time.Now()}},
+			expected: []float64{500, 300},
+		},
+		{
+			name:     "stale measurement",
+			paths:    pan.PathsMRU{slow, fast},
+			measured: map[pan.PathFingerprint]throughputEntry{slow.Fingerprint: {kbps: 500, seen: time.Now().Add(-throughputTimeout)}},
+			expected: []float64{100, 300},
+		},
+		{"unknown bandwidth gets the smallest", pan.PathsMRU{fast, unannounced, bare, slow}, nil, []float64{300, 100, 100, 100}},
+		{"nothing known", pan.PathsMRU{unannounced, bare}, nil, []float64{1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srs := NewStripingReplySelector(NewMemoryPathSource(), BandwidthPolicy{}, 5, NewPathStats())
+			for pf, e := range tt.measured {
+				srs.measured[pf] = e
+			}
+			weights := srs.weights(tt.paths)
+			if len(weights) != len(tt.expected) {
+				t.Fatalf("weights %v, expected %v", weights, tt.expected)
+			}
+			for i := range weights {
+				if weights[i] != tt.expected[i] {
+					t.Fatalf("weights %v, expected %v", weights, tt.expected)
+				}
+			}
+		})
+	}
+}
+
+func TestStripingObserveThroughput(t *testing.T) {
+	p := testPath(1, 2)
+	srs := NewStripingReplySelector(NewMemoryPathSource(), BandwidthPolicy{}, 5, NewPathStats())
+	srs.ObserveThroughput(p.Fingerprint, 1000)
+	srs.ObserveThroughput(p.Fingerprint, 2000)
+	if kbps := srs.measured[p.Fingerprint].kbps; kbps != 1000+throughputEWMAWeight*1000 {
+		t.Errorf("moving average %f after 1000 and 2000 Kbit/s", kbps)
+	}
+}
+
+// stripeShares counts the paths the next n replies to r are striped over
+func stripeShares(r *remoteEntry, weights []float64, n int) map[pan.PathFingerprint]int {
+	shares := make(map[pan.PathFingerprint]int)
+	for i := 0; i < n; i++ {
+		shares[stripe(r, weights).Fingerprint]++
+	}
+	return shares
+}
+
+func TestStripe(t *testing.T) {
+	a, b, c := testPath(1, 2), testPath(3, 4), testPath(5, 6)
+
+	tests := []struct {
+		name    string
+		weights []float64
+		// replies per path within one round of the total weight
+		expected []int
+	}{
+		{"equal", []float64{1, 1, 1}, []int{1, 1, 1}},
+		{"proportional", []float64{1, 3, 4}, []int{1, 3, 4}},
+		{"bandwidth", []float64{100, 300, 600}, []int{1, 3, 6}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &remoteEntry{}
+			r.Paths = pan.PathsMRU{a, b, c}
+			round := 0
+			for _, n := range tt.expected {
+				round += n
+			}
+			// every round of the total weight gets the same shares
+			for i := 0; i < 3; i++ {
+				shares := stripeShares(r, tt.weights, round)
+				for j, p := range r.Paths {
+					if shares[p.Fingerprint] != tt.expected[j] {
+						t.Fatalf("round %d striped %v, expected %v", i, shares, tt.expected)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestStripeInterleaves(t *testing.T) {
+	a, b := testPath(1, 2), testPath(3, 4)
+	r := &remoteEntry{}
+	r.Paths = pan.PathsMRU{a, b}
+	// a heavier path does not get its share in one burst
+	for i, e := range []*pan.Path{b, a, b, b, b, a, b, b} {
+		if p := stripe(r, []float64{1, 3}); p != e {
+			t.Fatalf("reply %d over %s, expected %s", i, p.Fingerprint, e.Fingerprint)
+		}
+	}
+
+	// the credit of a removed path is forgotten
+	r.Paths = pan.PathsMRU{b}
+	stripe(r, []float64{1})
+	if _, ok := r.credits[a.Fingerprint]; ok || len(r.credits) != 1 {
+		t.Errorf("credits %v after removing a path", r.credits)
+	}
+}
+
+func TestStripingReplySelector(t *testing.T) {
+	slow, fast := metaPath(1, 2, 1400, 0, 100), metaPath(3, 4, 1400, 0, 300)
+	mps := NewMemoryPathSource()
+	mps.SetPaths(testRemoteIA, []*pan.Path{slow, fast})
+	srs := NewStripingReplySelector(mps, BandwidthPolicy{}, 5, NewPathStats())
+	remote := testRemote(1)
+	if srs.Path(remote) != nil {
+		t.Fatal("reply path to an unknown remote")
+	}
+	srs.Record(remote, slow)
+
+	shares := make(map[pan.PathFingerprint]int)
+	for i := 0; i < 400; i++ {
+		shares[srs.Path(remote).Fingerprint]++
+	}
+	if shares[slow.Fingerprint] != 100 || shares[fast.Fingerprint] != 300 {
+		t.Errorf("striped %v, expected the advertised bandwidth shares 100 and 300", shares)
+	}
+
+	// a measurement shifts the shares
+	srs.ObserveThroughput(slow.Fingerprint, 900)
+	shares = make(map[pan.PathFingerprint]int)
+	for i := 0; i < 400; i++ {
+		shares[srs.Path(remote).Fingerprint]++
+	}
+	if shares[slow.Fingerprint] != 300 || shares[fast.Fingerprint] != 100 {
+		t.Errorf("striped %v, expected the measured shares 300 and 100", shares)
+	}
+}
+
+func TestStripingSample(t *testing.T) {
+	a, b := testPath(1, 2), testPath(3, 4)
+	stats := NewPathStats()
+	srs := NewStripingReplySelector(NewMemoryPathSource(), BandwidthPolicy{}, 5, stats)
+	stats.ObserveDelivered(a.Fingerprint, 1000)
+
+	// the first sample of a path has nothing to compare with
+	srs.sample(pan.PathsMRU{a, b})
+	if len(srs.measured) != 0 {
+		t.Fatalf("throughput %v measured from the first sample", srs.measured)
+	}
+	if _, ok := srs.delivered[b.Fingerprint]; ok {
+		t.Error("path without observations sampled")
+	}
+
+	// 125000 bytes delivered within a second are 1000 Kbit/s
+	last := srs.delivered[a.Fingerprint]
+	last.at = last.at.Add(-throughputSampleInterval)
+	srs.delivered[a.Fingerprint] = last
+	stats.ObserveDelivered(a.Fingerprint, 125000)
+	srs.sample(pan.PathsMRU{a, b})
+	if kbps := srs.measured[a.Fingerprint].kbps; kbps < 990 || kbps > 1000 {
+		t.Errorf("throughput %f Kbit/s, expected 1000", kbps)
+	}
+
+	// paths are sampled at most every throughputSampleInterval
+	stats.ObserveDelivered(a.Fingerprint, 125000)
+	srs.sample(pan.PathsMRU{a, b})
+	if kbps := srs.measured[a.Fingerprint].kbps; kbps > 1000 {
+		t.Errorf("throughput %f Kbit/s after sampling again within the interval", kbps)
+	}
+}
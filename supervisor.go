@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// time the servers get to finish their active requests once a shutdown is requested
+const defaultShutdownTimeout = 10 * time.Second
+
+// Supervisor runs the servers until a termination signal arrives and shuts them down gracefully.
+// A failing server is reported but does not stop the others.
+type Supervisor struct {
+	ShutdownTimeout time.Duration
+	servers         []supervisedServer
+	exits           chan supervisedExit
+}
+
+// shutdownServer is implemented by http.Server and SCIONServer
+type shutdownServer interface {
+	Shutdown(ctx context.Context) error
+	Close() error
+}
+
+type supervisedServer struct {
+	name string
+	srv  shutdownServer
+}
+
+type supervisedExit struct {
+	idx int
+	err error
+}
+
+// ServerExit reports how a supervised server stopped, Err is nil after a graceful shutdown
+type ServerExit struct {
+	Name string
+	Err  error
+}
+
+func NewSupervisor() *Supervisor {
+	return &Supervisor{
+		ShutdownTimeout: defaultShutdownTimeout,
+		exits:           make(chan supervisedExit),
+	}
+}
+
+// Go runs serve in the background, srv is shut down when the supervisor stops.
+// All servers have to be started before Run is called.
+func (sup *Supervisor) Go(name string, srv shutdownServer, serve func() error) {
+	idx := len(sup.servers)
+	sup.servers = append(sup.servers, supervisedServer{name: name, srv: srv})
+	go func() {
+		err := serve()
+		if errors.Is(err, http.ErrServerClosed) {
+			err = nil
+		}
+		sup.exits <- supervisedExit{idx: idx, err: err}
+	}()
+}
+
+// Run blocks until ctx is done, SIGINT, SIGTERM or SIGHUP is received or all servers
+// exited, then shuts down the remaining servers and returns the exit status per server
+func (sup *Supervisor) Run(ctx context.Context) []ServerExit {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer stop()
+
+	exits := make([]ServerExit, len(sup.servers))
+	running := make(map[int]bool)
+	for i, s := range sup.servers {
+		exits[i].Name = s.name
+		running[i] = true
+	}
+	for len(running) > 0 {
+		select {
+		case <-ctx.Done():
+			log.Printf("Supervisor: shutting down %d server(s)\n", len(running))
+			sup.shutdown(running, exits)
+			return exits
+		case e := <-sup.exits:
+			delete(running, e.idx)
+			exits[e.idx].Err = e.err
+			if e.err != nil {
+				log.Printf("Supervisor: %s server failed: %v\n", exits[e.idx].Name, e.err)
+			}
+		}
+	}
+	return exits
+}
+
+// shutdown drains the running servers within ShutdownTimeout and closes those that
+// did not finish in time, closing a server closes its listeners and reply selector
+func (sup *Supervisor) shutdown(running map[int]bool, exits []ServerExit) {
+	ctx, cancel := context.WithTimeout(context.Background(), sup.ShutdownTimeout)
+	defer cancel()
+
+	drained := make(chan supervisedExit, len(running))
+	for i := range running {
+		go func(i int) {
+			srv := sup.servers[i].srv
+			err := srv.Shutdown(ctx)
+			if err != nil {
+				_ = srv.Close()
+				err = fmt.Errorf("shutdown: %w", err)
+			}
+			drained <- supervisedExit{idx: i, err: err}
+		}(i)
+	}
+	// wait for every server to drain and its serve function to return
+	for pending := 2 * len(running); pending > 0; pending-- {
+		var e supervisedExit
+		select {
+		case e = <-drained:
+		case e = <-sup.exits:
+		}
+		if e.err != nil && exits[e.idx].Err == nil {
+			exits[e.idx].Err = e.err
+		}
+	}
+}
+
+// Wait runs the supervisor and logs the exit status of every server,
+// it returns false if any server failed
+func (sup *Supervisor) Wait() bool {
+	ok := true
+	for _, exit := range sup.Run(context.Background()) {
+		if exit.Err != nil {
+			ok = false
+			log.Printf("%s server: %v\n", exit.Name, exit.Err)
+		} else {
+			log.Printf("%s server: stopped\n", exit.Name)
+		}
+	}
+	return ok
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeServer serves until it is shut down or closed. A shutdown waits for drain
+// to be closed, so that the active requests of a server can be simulated.
+type fakeServer struct {
+	mtx      sync.Mutex
+	stopped  chan struct{}
+	drain    chan struct{}
+	shutdown bool
+	closed   bool
+}
+
+func newFakeServer() *fakeServer {
+	drain := make(chan struct{})
+	close(drain)
+	return &fakeServer{stopped: make(chan struct{}), drain: drain}
+}
+
+func (fs *fakeServer) serve() error {
+	<-fs.stopped
+	return http.ErrServerClosed
+}
+
+func (fs *fakeServer) stop() {
+	fs.mtx.Lock()
+	defer fs.mtx.Unlock()
+	select {
+	case <-fs.stopped:
+	default:
+		close(fs.stopped)
+	}
+}
+
+func (fs *fakeServer) Shutdown(ctx context.Context) error {
+	fs.mtx.Lock()
+	fs.shutdown = true
+	fs.mtx.Unlock()
+	select {
+	case <-fs.drain:
+		fs.stop()
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (fs *fakeServer) Close() error {
+	fs.mtx.Lock()
+	fs.closed = true
+	fs.mtx.Unlock()
+	fs.stop()
+	return nil
+}
+
+func (fs *fakeServer) state() (shutdown, closed bool) {
+	fs.mtx.Lock()
+	defer fs.mtx.Unlock()
+	return fs.shutdown, fs.closed
+}
+
+func TestSupervisorShutdown(t *testing.T) {
+	sup := NewSupervisor()
+	drained, stuck := newFakeServer(), newFakeServer()
+	stuck.drain = make(chan struct{})
+	sup.ShutdownTimeout = 50 * time.Millisecond
+	sup.Go("drained", drained, drained.serve)
+	sup.Go("stuck", stuck, stuck.serve)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	exits := sup.Run(ctx)
+
+	if len(exits) != 2 || exits[0].Name != "drained" || exits[1].Name != "stuck" {
+		t.Fatalf("got exits %v, expected one per server in their order", exits)
+	}
+	if shutdown, closed := drained.state(); !shutdown || closed || exits[0].Err != nil {
+		t.Errorf("drained server shut down %t, closed %t with %v, expected a graceful shutdown", shutdown, closed, exits[0].Err)
+	}
+	// a server that does not drain in time is closed
+	if shutdown, closed := stuck.state(); !shutdown || !closed {
+		t.Errorf("stuck server shut down %t and closed %t, expected both", shutdown, closed)
+	}
+	if err := exits[1].Err; !errors.Is(err, context.DeadlineExceeded) || !strings.HasPrefix(err.Error(), "shutdown: ") {
+		t.Errorf("stuck server exited with %v, expected the shutdown timeout", err)
+	}
+}
+
+func TestSupervisorDrain(t *testing.T) {
+	sup := NewSupervisor()
+	srv := newFakeServer()
+	srv.drain = make(chan struct{})
+	sup.Go("web", srv, srv.serve)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	done := make(chan []ServerExit)
+	go func() { done <- sup.Run(ctx) }()
+
+	// the supervisor waits for the active requests to finish
+	select {
+	case <-done:
+		t.Fatal("supervisor returned before the server drained")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(srv.drain)
+	if exits := <-done; exits[0].Err != nil {
+		t.Errorf("server exited with %v after draining", exits[0].Err)
+	}
+	if _, closed := srv.state(); closed {
+		t.Error("drained server was closed")
+	}
+}
+
+func TestSupervisorServerFails(t *testing.T) {
+	sup := NewSupervisor()
+	errListen := errors.New("address already in use")
+	srv := newFakeServer()
+	sup.Go("failing", newFakeServer(), func() error { return errListen })
+	sup.Go("web", srv, srv.serve)
+
+	done := make(chan bool)
+	go func() { done <- sup.Wait() }()
+	// a failing server does not stop the others
+	select {
+	case <-done:
+		t.Fatal("supervisor returned while a server is running")
+	case <-time.After(20 * time.Millisecond):
+	}
+	srv.stop()
+	if <-done {
+		t.Error("wait succeeded although a server failed")
+	}
+}
+
+func TestSupervisorWait(t *testing.T) {
+	sup := NewSupervisor()
+	srv := newFakeServer()
+	sup.Go("web", srv, srv.serve)
+	srv.stop()
+	if !sup.Wait() {
+		t.Error("wait failed although every server stopped gracefully")
+	}
+}
+
+func TestSupervisorSignal(t *testing.T) {
+	// keep SIGHUP from terminating the test before or after the supervisor handles it
+	signal.Notify(make(chan os.Signal, 1), syscall.SIGHUP)
+
+	sup := NewSupervisor()
+	srv := newFakeServer()
+	sup.Go("web", srv, srv.serve)
+	done := make(chan []ServerExit)
+	go func() { done <- sup.Run(context.Background()) }()
+
+	// the supervisor may not be notified yet, repeat the signal until it returns
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	timeout := time.After(5 * time.Second)
+	for {
+		if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case exits := <-done:
+			if shutdown, _ := srv.state(); !shutdown || exits[0].Err != nil {
+				t.Errorf("server shut down %t with %v on the signal", shutdown, exits[0].Err)
+			}
+			return
+		case <-ticker.C:
+		case <-timeout:
+			t.Fatal("supervisor did not stop on the signal")
+		}
+	}
+}
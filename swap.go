@@ -0,0 +1,135 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+// the replaced selector keeps serving remotes the new selector has not recorded yet for this long
+const swapGracePeriod = 30 * time.Second
+
+// SwappableReplySelector wraps the reply selector of a listener so that it can be
+// replaced at runtime without closing the listener or its QUIC connections
+type SwappableReplySelector struct {
+	mtx      sync.RWMutex
+	current  pan.ReplySelector
+	previous pan.ReplySelector
+	retire   *time.Timer
+	local    pan.UDPAddr
+	users    int
+	// how long the replaced selector is kept, swapGracePeriod outside of tests
+	grace time.Duration
+	// metrics label passed on to swapped in selectors
+	name string
+}
+
+func NewSwappableReplySelector(rs pan.ReplySelector) *SwappableReplySelector {
+	return &SwappableReplySelector{current: rs, grace: swapGracePeriod}
+}
+
+// Current returns the active reply selector
+func (srs *SwappableReplySelector) Current() pan.ReplySelector {
+	srs.mtx.RLock()
+	defer srs.mtx.RUnlock()
+	return srs.current
+}
+
+// Swap activates rs. The replaced selector answers for remotes rs has no path
+// for during the grace period and is closed afterwards.
+// Selectors are closed after mtx is released, as closing waits for their
+// background queries and replies must not be blocked meanwhile.
+func (srs *SwappableReplySelector) Swap(rs pan.ReplySelector) {
+	srs.mtx.Lock()
+	if ns, ok := rs.(namedSelector); ok && srs.name != "" {
+		ns.SetName(srs.name)
+	}
+	// initialize rs once per listener using the selector
+	for i := 0; i < srs.users; i++ {
+		rs.Initialize(srs.local)
+	}
+	replaced := srs.previous
+	if replaced != nil {
+		srs.retire.Stop()
+	}
+	old := srs.current
+	srs.previous = old
+	srs.current = rs
+	users := srs.users
+	srs.retire = time.AfterFunc(srs.grace, func() {
+		srs.mtx.Lock()
+		retired := srs.previous == old
+		if retired {
+			srs.previous = nil
+		}
+		users := srs.users
+		srs.mtx.Unlock()
+		if retired {
+			closeSelector(old, users)
+		}
+	})
+	srs.mtx.Unlock()
+
+	if replaced != nil {
+		closeSelector(replaced, users)
+	}
+}
+
+// closeSelector closes rs once per listener using it
+func closeSelector(rs pan.ReplySelector, users int) {
+	for i := 0; i < users; i++ {
+		_ = rs.Close()
+	}
+}
+
+func (srs *SwappableReplySelector) Path(remote pan.UDPAddr) *pan.Path {
+	srs.mtx.RLock()
+	defer srs.mtx.RUnlock()
+	if p := srs.current.Path(remote); p != nil || srs.previous == nil {
+		return p
+	}
+	return srs.previous.Path(remote)
+}
+
+func (srs *SwappableReplySelector) Initialize(local pan.UDPAddr) {
+	srs.mtx.Lock()
+	defer srs.mtx.Unlock()
+	srs.local = local
+	srs.users += 1
+	srs.current.Initialize(local)
+	if srs.previous != nil {
+		srs.previous.Initialize(local)
+	}
+}
+
+func (srs *SwappableReplySelector) Record(remote pan.UDPAddr, path *pan.Path) {
+	srs.Current().Record(remote, path)
+}
+
+func (srs *SwappableReplySelector) PathDown(pf pan.PathFingerprint, pi pan.PathInterface) {
+	srs.mtx.RLock()
+	defer srs.mtx.RUnlock()
+	srs.current.PathDown(pf, pi)
+	if srs.previous != nil {
+		srs.previous.PathDown(pf, pi)
+	}
+}
+
+func (srs *SwappableReplySelector) Close() error {
+	srs.mtx.Lock()
+	if srs.users > 0 {
+		srs.users -= 1
+	}
+	current, previous := srs.current, srs.previous
+	if previous != nil && srs.users == 0 {
+		srs.retire.Stop()
+		srs.previous = nil
+	}
+	srs.mtx.Unlock()
+
+	if previous != nil {
+		_ = previous.Close()
+	}
+	return current.Close()
+}
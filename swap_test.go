@@ -0,0 +1,193 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+// fakeSelector replies over fixed paths per remote and records the calls it gets
+type fakeSelector struct {
+	mtx      sync.Mutex
+	paths    map[pan.UDPAddr]*pan.Path
+	inits    int
+	closes   int
+	closed   time.Time
+	recorded []pan.UDPAddr
+	down     []pan.PathFingerprint
+	// called by Close, e.g. to wait for background queries
+	onClose func()
+}
+
+func newFakeSelector(paths map[pan.UDPAddr]*pan.Path) *fakeSelector {
+	return &fakeSelector{paths: paths}
+}
+
+func (fs *fakeSelector) Path(remote pan.UDPAddr) *pan.Path {
+	fs.mtx.Lock()
+	defer fs.mtx.Unlock()
+	return fs.paths[remote]
+}
+
+func (fs *fakeSelector) Initialize(local pan.UDPAddr) {
+	fs.mtx.Lock()
+	defer fs.mtx.Unlock()
+	fs.inits++
+}
+
+func (fs *fakeSelector) Record(remote pan.UDPAddr, path *pan.Path) {
+	fs.mtx.Lock()
+	defer fs.mtx.Unlock()
+	fs.recorded = append(fs.recorded, remote)
+}
+
+func (fs *fakeSelector) PathDown(pf pan.PathFingerprint, pi pan.PathInterface) {
+	fs.mtx.Lock()
+	defer fs.mtx.Unlock()
+	fs.down = append(fs.down, pf)
+}
+
+func (fs *fakeSelector) Close() error {
+	fs.mtx.Lock()
+	fs.closes++
+	fs.closed = time.Now()
+	onClose := fs.onClose
+	fs.mtx.Unlock()
+	if onClose != nil {
+		onClose()
+	}
+	return nil
+}
+
+// counts returns the number of Initialize and Close calls
+func (fs *fakeSelector) counts() (int, int) {
+	fs.mtx.Lock()
+	defer fs.mtx.Unlock()
+	return fs.inits, fs.closes
+}
+
+func expectCounts(t *testing.T, name string, fs *fakeSelector, inits, closes int) {
+	t.Helper()
+	if i, c := fs.counts(); i != inits || c != closes {
+		t.Errorf("%s initialized %d and closed %d times, expected %d and %d", name, i, c, inits, closes)
+	}
+}
+
+func TestSwapGracePeriod(t *testing.T) {
+	a, b := testPath(1, 2), testPath(3, 4)
+	known, unknown := testRemote(1), testRemote(2)
+	old := newFakeSelector(map[pan.UDPAddr]*pan.Path{known: a, unknown: a})
+	rs := newFakeSelector(map[pan.UDPAddr]*pan.Path{known: b})
+
+	srs := NewSwappableReplySelector(old)
+	srs.grace = 50 * time.Millisecond
+	// two listeners use the selector
+	srs.Initialize(testRemote(0))
+	srs.Initialize(testRemote(0))
+	swapped := time.Now()
+	srs.Swap(rs)
+
+	if srs.Current() != rs {
+		t.Fatal("swapped selector is not current")
+	}
+	expectCounts(t, "new selector", rs, 2, 0)
+	// remotes the new selector has no path for are replied to by the old one
+	expectPaths(t, srs, known, b)
+	expectPaths(t, srs, unknown, a)
+	srs.Record(known, b)
+	if len(rs.recorded) != 1 || len(old.recorded) != 0 {
+		t.Errorf("recorded in the new selector %d and the old one %d times, expected only the new one", len(rs.recorded), len(old.recorded))
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for _, closes := old.counts(); closes < 2 && time.Now().Before(deadline); _, closes = old.counts() {
+		time.Sleep(time.Millisecond)
+	}
+	expectCounts(t, "old selector", old, 2, 2)
+	old.mtx.Lock()
+	closed := old.closed
+	old.mtx.Unlock()
+	if closed.Sub(swapped) < srs.grace {
+		t.Errorf("old selector closed after %s, before the grace period", closed.Sub(swapped))
+	}
+	expectPaths(t, srs, unknown, nil)
+	expectCounts(t, "new selector", rs, 2, 0)
+}
+
+func TestSwapTwice(t *testing.T) {
+	first, second, third := newFakeSelector(nil), newFakeSelector(nil), newFakeSelector(nil)
+	srs := NewSwappableReplySelector(first)
+	srs.Initialize(testRemote(0))
+
+	srs.Swap(second)
+	// a second swap within the grace period closes the first selector at once
+	srs.Swap(third)
+	expectCounts(t, "first selector", first, 1, 1)
+	expectCounts(t, "second selector", second, 1, 0)
+	expectCounts(t, "third selector", third, 1, 0)
+
+	// the previous selector still learns about paths that are down
+	srs.PathDown("1 2", pan.PathInterface{})
+	if len(second.down) != 1 || len(third.down) != 1 || len(first.down) != 0 {
+		t.Errorf("path down forwarded to %d, %d and %d selectors, expected only the current and previous one",
+			len(first.down), len(second.down), len(third.down))
+	}
+
+	// closing the last listener closes the current and previous selector
+	srs.Close()
+	expectCounts(t, "second selector", second, 1, 1)
+	expectCounts(t, "third selector", third, 1, 1)
+	if srs.previous != nil {
+		t.Error("previous selector kept after the last listener closed")
+	}
+}
+
+func TestSwapUsers(t *testing.T) {
+	old, rs := newFakeSelector(nil), newFakeSelector(nil)
+	srs := NewSwappableReplySelector(old)
+	srs.Initialize(testRemote(0))
+	srs.Initialize(testRemote(0))
+	srs.Swap(rs)
+	// a listener started after the swap initializes both selectors
+	srs.Initialize(testRemote(0))
+	expectCounts(t, "old selector", old, 3, 0)
+	expectCounts(t, "new selector", rs, 3, 0)
+
+	srs.Close()
+	srs.Close()
+	expectCounts(t, "old selector", old, 3, 2)
+	expectCounts(t, "new selector", rs, 3, 2)
+	if srs.previous == nil {
+		t.Error("previous selector dropped while a listener uses it")
+	}
+	srs.Close()
+	expectCounts(t, "old selector", old, 3, 3)
+	expectCounts(t, "new selector", rs, 3, 3)
+}
+
+func TestSwapCloseUnlocked(t *testing.T) {
+	a := testPath(1, 2)
+	remote := testRemote(1)
+	first := newFakeSelector(nil)
+	second := newFakeSelector(map[pan.UDPAddr]*pan.Path{remote: a})
+	srs := NewSwappableReplySelector(first)
+	srs.Initialize(testRemote(0))
+
+	// replies are served while a replaced selector is closing
+	first.onClose = func() { srs.Path(remote) }
+	srs.Swap(second)
+	done := make(chan struct{})
+	go func() {
+		srs.Swap(newFakeSelector(nil))
+		srs.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("closing a replaced selector blocks the replies")
+	}
+	expectCounts(t, "first selector", first, 1, 1)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+// PathWeigher derives the share of replies of every path of a remote,
+// ids holds the path ID every path was chosen as or -1 if unknown
+type PathWeigher interface {
+	Weights(paths pan.PathsMRU, ids []int) []float64
+}
+
+// ExplicitWeights gives the path chosen as path ID i the i-th weight, paths with other
+// IDs get none. The IDs are kept when paths go down or are reordered by a refresh,
+// so the weights stay with their paths. The paths share equally if none of them has a weight.
+type ExplicitWeights []float64
+
+func (w ExplicitWeights) Weights(paths pan.PathsMRU, ids []int) []float64 {
+	weights := make([]float64, len(paths))
+	for i, id := range ids {
+		if id >= 0 && id < len(w) {
+			weights[i] = w[id]
+		}
+	}
+	for _, v := range weights {
+		if v > 0 {
+			return weights
+		}
+	}
+	fillUnknownWeights(weights)
+	return weights
+}
+
+// InverseLatencyWeights shares the replies inversely proportional to the latency of the
+// paths, measured if Measured knows it and announced otherwise. Paths of unknown latency
+// get the smallest known weight.
+type InverseLatencyWeights struct {
+	Measured LatencyEstimator
+}
+
+func (w InverseLatencyWeights) Weights(paths pan.PathsMRU, ids []int) []float64 {
+	weights := make([]float64, len(paths))
+	for i, p := range paths {
+		lat, ok := time.Duration(0), false
+		if w.Measured != nil {
+			lat, ok = w.Measured.Latency(p.Fingerprint)
+		}
+		if !ok && p.Metadata != nil {
+			var unknown pan.PathHopSet
+			lat, unknown = p.Metadata.LatencySum()
+			ok = len(unknown) == 0
+		}
+		if ok && lat > 0 {
+			weights[i] = 1 / lat.Seconds()
+		}
+	}
+	fillUnknownWeights(weights)
+	return weights
+}
+
+// BandwidthWeights shares the replies proportionally to the announced bottleneck
+// bandwidth of the paths. Paths of unknown bandwidth get the smallest known weight.
+type BandwidthWeights struct{}
+
+func (BandwidthWeights) Weights(paths pan.PathsMRU, ids []int) []float64 {
+	weights := make([]float64, len(paths))
+	for i, p := range paths {
+		if p.Metadata == nil {
+			continue
+		}
+		// the minimum over no announced hop is math.MaxUint64
+		if bw, _ := p.Metadata.BandwidthMin(); bw != math.MaxUint64 {
+			weights[i] = float64(bw)
+		}
+	}
+	fillUnknownWeights(weights)
+	return weights
+}
+
+// fillUnknownWeights gives paths without a weight the smallest known one,
+// all paths share equally if none is known
+func fillUnknownWeights(weights []float64) {
+	smallest := 0.0
+	for _, w := range weights {
+		if w > 0 && (smallest == 0 || w < smallest) {
+			smallest = w
+		}
+	}
+	if smallest == 0 {
+		smallest = 1
+	}
+	for i := range weights {
+		if weights[i] == 0 {
+			weights[i] = smallest
+		}
+	}
+}
+
+// WeightedReplySelector rotates over the paths of a remote by smooth weighted round-robin,
+// so every path gets a share of the replies proportional to its weight instead of the
+// same number of consecutive replies. The weigher can be replaced at runtime.
+// The paths are chosen by the embedded CBReplySelector, only Path differs.
+type WeightedReplySelector struct {
+	*CBReplySelector
+	wmtx    sync.RWMutex
+	weigher PathWeigher
+	// weighted path IDs in the order their weights are given, nil if the best paths are weighted
+	pathIDs []int
+}
+
+// the policy bounds the weighted paths of a remote to the best nr_paths
+func NewWeightedReplySelector(src PathSource, policy PathPolicy, nr_paths int, weigher PathWeigher) *WeightedReplySelector {
+	wrs := &WeightedReplySelector{
+		CBReplySelector: NewCBReplySelector(src, policy, nr_paths, 0),
+		weigher:         weigher,
+	}
+	wrs.rrrs.name = "weighted"
+	return wrs
+}
+
+// NewWeightedStrategicReplySelector weights the selected path IDs like a selective
+// StrategicReplySelector picks them, e.g. path IDs [2, 4] with weights [3, 1] send
+// three quarters of the replies over path 2 and one quarter over path 4
+func NewWeightedStrategicReplySelector(src PathSource, policy PathPolicy, pathIDs []int, weights []float64) *WeightedReplySelector {
+	srs := newStrategicReplySelector(src, policy, pathIDs, 0)
+	srs.cbrs.rrrs.name = "weighted"
+	return &WeightedReplySelector{
+		CBReplySelector: srs.cbrs,
+		weigher:         weightsByID(pathIDs, weights),
+		pathIDs:         append([]int{}, pathIDs...),
+	}
+}
+
+// weightsByID gives the path chosen as the i-th path ID the i-th weight
+func weightsByID(pathIDs []int, weights []float64) ExplicitWeights {
+	n := 0
+	for _, id := range pathIDs {
+		if id+1 > n {
+			n = id + 1
+		}
+	}
+	w := make(ExplicitWeights, n)
+	for i, id := range pathIDs {
+		if id >= 0 && i < len(weights) {
+			w[id] = weights[i]
+		}
+	}
+	return w
+}
+
+// SetWeigher replaces the weights of all paths, the shares change with the next reply
+func (wrs *WeightedReplySelector) SetWeigher(weigher PathWeigher) {
+	wrs.wmtx.Lock()
+	defer wrs.wmtx.Unlock()
+	wrs.weigher = weigher
+}
+
+// SetWeights replaces the weights by explicit ones, given in the order of the path IDs
+// if the selector weights path IDs
+func (wrs *WeightedReplySelector) SetWeights(weights []float64) error {
+	if wrs.pathIDs == nil {
+		wrs.SetWeigher(ExplicitWeights(append([]float64{}, weights...)))
+		return nil
+	}
+	if len(weights) != len(wrs.pathIDs) {
+		return fmt.Errorf("expected %d weights for path IDs %v", len(wrs.pathIDs), wrs.pathIDs)
+	}
+	wrs.SetWeigher(weightsByID(wrs.pathIDs, weights))
+	return nil
+}
+
+// weights weighs the paths of the remote by the path IDs they were chosen as,
+// the caller must hold the mtx of the selector
+func (wrs *WeightedReplySelector) weights(r *remoteEntry) []float64 {
+	ids := make([]int, len(r.Paths))
+	for i, p := range r.Paths {
+		if id, ok := r.ids[p.Fingerprint]; ok {
+			ids[i] = id
+		} else {
+			ids[i] = -1
+		}
+	}
+	wrs.wmtx.RLock()
+	defer wrs.wmtx.RUnlock()
+	return wrs.weigher.Weights(r.Paths, ids)
+}
+
+func (wrs *WeightedReplySelector) Path(remote pan.UDPAddr) *pan.Path {
+	rrrs := wrs.rrrs
+	rrrs.mtx.Lock()
+	defer rrrs.mtx.Unlock()
+	r, ok := rrrs.remotes[remote]
+	if !ok || len(r.Paths) == 0 {
+		return nil
+	}
+	return stripe(r, wrs.weights(r))
+}
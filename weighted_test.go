@@ -0,0 +1,183 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+func expectWeights(t *testing.T, weights, expected []float64) {
+	t.Helper()
+	if len(weights) != len(expected) {
+		t.Fatalf("weights %v, expected %v", weights, expected)
+	}
+	for i := range weights {
+		if weights[i] != expected[i] {
+			t.Fatalf("weights %v, expected %v", weights, expected)
+		}
+	}
+}
+
+func TestFillUnknownWeights(t *testing.T) {
+	tests := []struct {
+		name     string
+		weights  []float64
+		expected []float64
+	}{
+		{"all known", []float64{2, 3}, []float64{2, 3}},
+		{"unknown get the smallest", []float64{0, 3, 2, 0}, []float64{2, 3, 2, 2}},
+		{"none known", []float64{0, 0}, []float64{1, 1}},
+		{"negative are known", []float64{-1, 0, 4}, []float64{-1, 4, 4}},
+		{"no paths", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			weights := append([]float64{}, tt.weights...)
+			fillUnknownWeights(weights)
+			expectWeights(t, weights, tt.expected)
+		})
+	}
+}
+
+func TestExplicitWeights(t *testing.T) {
+	paths := pan.PathsMRU{testPath(1, 2), testPath(3, 4), testPath(5, 6)}
+
+	tests := []struct {
+		name    string
+		weights ExplicitWeights
+		// path ID per path, -1 if unknown
+		ids      []int
+		expected []float64
+	}{
+		{"one per path", ExplicitWeights{3, 1, 2}, []int{0, 1, 2}, []float64{3, 1, 2}},
+		{"weights follow the path IDs", ExplicitWeights{3, 1, 2}, []int{2, 0, 1}, []float64{2, 3, 1}},
+		{"fewer paths", ExplicitWeights{3, 1, 2}, []int{1, 2}, []float64{1, 2}},
+		{"unknown path IDs get none", ExplicitWeights{3, 1}, []int{0, -1, 5}, []float64{3, 0, 0}},
+		{"none positive share equally", ExplicitWeights{0, 0}, []int{0, 1, 2}, []float64{1, 1, 1}},
+		{"no weights", nil, []int{0, 1}, []float64{1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectWeights(t, tt.weights.Weights(paths[:len(tt.ids)], tt.ids), tt.expected)
+		})
+	}
+}
+
+func TestDerivedWeights(t *testing.T) {
+	slow := metaPath(1, 2, 1400, 20*time.Millisecond, 100)
+	fast := metaPath(3, 4, 1400, 10*time.Millisecond, 300)
+	unknown := metaPath(5, 6, 1400, 0, 0)
+	bare := &pan.Path{Source: testLocalIA, Destination: testRemoteIA, Fingerprint: "bare"}
+	measured := NewPathStats()
+	measured.ObserveRTT(slow.Fingerprint, 80*time.Millisecond)
+
+	tests := []struct {
+		name     string
+		weigher  PathWeigher
+		expected []float64
+	}{
+		{"bandwidth", BandwidthWeights{}, []float64{100, 300, 100, 100}},
+		{"announced latency", InverseLatencyWeights{}, []float64{50, 100, 50, 50}},
+		{"measured latency", InverseLatencyWeights{Measured: measured}, []float64{25, 100, 25, 25}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			weights := tt.weigher.Weights(pan.PathsMRU{slow, fast, unknown, bare}, nil)
+			for i := range weights {
+				// inverse latencies are not exact
+				if d := weights[i] - tt.expected[i]; d > 1e-9 || d < -1e-9 {
+					t.Fatalf("weights %v, expected %v", weights, tt.expected)
+				}
+			}
+		})
+	}
+}
+
+func TestWeightsByID(t *testing.T) {
+	tests := []struct {
+		name     string
+		pathIDs  []int
+		weights  []float64
+		expected ExplicitWeights
+	}{
+		{"in order", []int{0, 1}, []float64{3, 1}, ExplicitWeights{3, 1}},
+		{"unordered with gaps", []int{4, 0, 2}, []float64{1, 2, 3}, ExplicitWeights{2, 0, 3, 0, 1}},
+		{"negative path IDs are skipped", []int{-1, 1}, []float64{5, 2}, ExplicitWeights{0, 2}},
+		{"fewer weights", []int{0, 1}, []float64{7}, ExplicitWeights{7, 0}},
+		{"no path IDs", nil, []float64{1}, ExplicitWeights{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectWeights(t, weightsByID(tt.pathIDs, tt.weights), tt.expected)
+		})
+	}
+}
+
+// replyShares counts the paths of the next n replies to remote
+func replyShares(rs pan.ReplySelector, remote pan.UDPAddr, n int) map[pan.PathFingerprint]int {
+	shares := make(map[pan.PathFingerprint]int)
+	for i := 0; i < n; i++ {
+		if p := rs.Path(remote); p != nil {
+			shares[p.Fingerprint]++
+		}
+	}
+	return shares
+}
+
+func TestWeightedReplySelector(t *testing.T) {
+	a, b, c := testPath(1, 2), testPath(3, 4), testPath(5, 6)
+	mps := NewMemoryPathSource()
+	mps.SetPaths(testRemoteIA, []*pan.Path{a, b, c})
+	remote := testRemote(1)
+
+	wrs := NewWeightedReplySelector(mps, nil, 2, ExplicitWeights{1, 3})
+	wrs.Record(remote, a)
+	if shares := replyShares(wrs, remote, 400); shares[a.Fingerprint] != 100 || shares[b.Fingerprint] != 300 {
+		t.Errorf("replies %v, expected 100 over the first and 300 over the second path", shares)
+	}
+	if err := wrs.SetWeights([]float64{1, 1, 5}); err != nil {
+		t.Fatal(err)
+	}
+	if shares := replyShares(wrs, remote, 400); shares[a.Fingerprint] != 200 || shares[b.Fingerprint] != 200 {
+		t.Errorf("replies %v, expected an equal share of the two best paths", shares)
+	}
+}
+
+func TestWeightedStrategicReplySelector(t *testing.T) {
+	a, b, c := testPath(1, 2), testPath(3, 4), testPath(5, 6)
+	mps := NewMemoryPathSource()
+	mps.SetPaths(testRemoteIA, []*pan.Path{a, b, c})
+	remote := testRemote(1)
+
+	wrs := NewWeightedStrategicReplySelector(mps, nil, []int{2, 0}, []float64{1, 3})
+	wrs.Record(remote, a)
+	if shares := replyShares(wrs, remote, 400); shares[c.Fingerprint] != 100 || shares[a.Fingerprint] != 300 || shares[b.Fingerprint] != 0 {
+		t.Errorf("replies %v, expected 100 over path ID 2 and 300 over path ID 0", shares)
+	}
+
+	if err := wrs.SetWeights([]float64{1}); err == nil {
+		t.Error("fewer weights than path IDs accepted")
+	}
+	if err := wrs.SetWeights([]float64{3, 1}); err != nil {
+		t.Fatal(err)
+	}
+	if shares := replyShares(wrs, remote, 400); shares[c.Fingerprint] != 300 || shares[a.Fingerprint] != 100 {
+		t.Errorf("replies %v, expected 300 over path ID 2 and 100 over path ID 0", shares)
+	}
+}
+
+func TestWeightedPathDown(t *testing.T) {
+	a, b, c := testPath(1, 2), testPath(3, 4), testPath(5, 6)
+	mps := NewMemoryPathSource()
+	mps.SetPaths(testRemoteIA, []*pan.Path{a, b, c})
+	remote := testRemote(1)
+
+	wrs := NewWeightedStrategicReplySelector(mps, nil, []int{0, 1, 2}, []float64{1, 2, 5})
+	wrs.Record(remote, a)
+	// the weights stay with the paths chosen as their path IDs when a path goes down
+	wrs.PathDown(a.Fingerprint, pan.PathInterface{})
+	if shares := replyShares(wrs, remote, 700); shares[b.Fingerprint] != 200 || shares[c.Fingerprint] != 500 {
+		t.Errorf("replies %v, expected 200 over path ID 1 and 500 over path ID 2", shares)
+	}
+}